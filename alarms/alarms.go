@@ -4,131 +4,293 @@ package alarms
 updates them in DB and notifies user*/
 
 import (
+	"database/sql"
 	"fmt"
-	"net"
-	"net/smtp"
+	"sync"
 	"time"
 
-	"github.com/miekg/dns"
 	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
 	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
 	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
 )
 
 var (
-	log        = bootstrap.GetLog()
-	dnsManager = bootstrap.GetConf().DNS.Manager
+	log     = bootstrap.GetLog()
+	policy  = bootstrap.GetConf().AlarmPolicy
+	workers = bootstrap.GetConf().AlarmChecks.Workers
 )
 
-//PeriodicAlarmCheck periodically makes sure that the thresholds are respected.
-//Otherwise notifies by e-mail and updates the DB
+//evaluation is the outcome of the check of an alarm, to be stored at the end of the round.
+//The notification that is due(state) is sent once the evaluation is stored
+type evaluation struct {
+	alarm    ermis.Alarm
+	event    *ermis.AlarmEvent
+	state    string
+	silenced bool
+}
+
+/*PeriodicAlarmCheck periodically makes sure that the thresholds are respected.
+Otherwise notifies the recipients. The aliases are evaluated by a pool of workers,
+the alarms of the same alias by the same worker, so that they share the lookups.
+The outcome of the round is stored in the DB at once, then the recipients are notified*/
 func PeriodicAlarmCheck() {
-	var alarms []ermis.Alarm
-	if err := db.GetConn().Find(&alarms).
-		Error; err != nil {
+	//The checkers need the nodes of the alias, so we retrieve the alarms through their aliases
+	aliases, err := ermis.GetObjects("all")
+	if err != nil {
 		log.Errorf("Could not retrieve alarms %v", err)
 	}
 
-	for _, alarm := range alarms {
-		if err := processThis(alarm); err != nil {
-			log.Errorf("Error updating the alert: %v and %v", err, alarm)
+	silences, err := ermis.ActiveSilences(time.Now())
+	if err != nil {
+		log.Errorf("Could not retrieve the silences %v", err)
+	}
+
+	startRound()
+	defer endRound()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []evaluation
+	)
+	jobs := make(chan ermis.Alias)
+	for i := 0; i < atLeastOne(workersOrDefault()); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for alias := range jobs {
+				for _, alarm := range alias.Alarms {
+					result := processThis(alias, alarm, ermis.Silenced(silences, alias, alarm))
+					mu.Lock()
+					results = append(results, result)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, alias := range aliases {
+		if len(alias.Alarms) > 0 {
+			jobs <- alias
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	//Only the stored transitions are notified, the others are evaluated again in the next round
+	if err := saveEvaluations(results); err != nil {
+		log.Errorf("Error updating the alerts, the notifications are not sent: %v", err)
+	} else {
+		notifyRecipients(results)
+		if err := notifyAdmins(results); err != nil {
+			log.Errorf("Could not alert the admins: %v", err)
 		}
 	}
+	if digestWindow > 0 {
+		if err := FlushDigests(time.Now()); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+//workersOrDefault returns the configured size of the pool, 10 by default
+func workersOrDefault() int {
+	if workers <= 0 {
+		return 10
+	}
+	return workers
+}
+
+/*processThis evaluates an alarm and applies the hysteresis of the alarm policy.
+An alarm fires after fire_after consecutive failing checks and resolves after
+resolve_after consecutive successful ones. While active, it is notified again
+every renotify minutes. The transitions of silenced alarms are recorded, but not notified.
+A check that cannot be evaluated leaves the alarm unknown, without counting it nor notifying the recipient.
+It returns the updated alarm, with its transition if the state changed and the notification that is due*/
+func processThis(alias ermis.Alias, alarm ermis.Alarm, silenced bool) evaluation {
+	result, observed := checkAlarm(alias, alarm.Name, alarm.Parameter)
+	alarm, event, state := ApplyPolicy(policy, alarm, result, observed, silenced, time.Now())
+	return pending(alarm, event, state, silenced)
 }
 
-func processThis(alarm ermis.Alarm) (err error) {
-	alarm.LastCheck.Time = time.Now()
-	alarm.LastCheck.Valid = true
-	newActive := false
-	if checkAlarm(alarm.Alias, alarm.Name, alarm.Parameter) {
+/*ApplyPolicy updates the alarm with the result of its check at now, following the policy p. It returns
+the updated alarm, its transition if the state changed and the notification that is due(firing, resolved or none)*/
+func ApplyPolicy(p bootstrap.AlarmPolicy, alarm ermis.Alarm, result string, observed int, silenced bool, now time.Time) (ermis.Alarm, *ermis.AlarmEvent, string) {
+	var event *ermis.AlarmEvent
+	previous := alarm.CurrentState()
+	alarm.LastCheck = sql.NullTime{Time: now, Valid: true}
+	switch result {
+	case ermis.StateFiring:
+		alarm.Failures++
+		alarm.Successes = 0
+	case ermis.StateOK:
+		alarm.Successes++
+		alarm.Failures = 0
+	}
+
+	state := ""
+	switch {
+	case result == ermis.StateUnknown:
+		log.Warnf("The alert %v on %v could not be evaluated", alarm.Name, alarm.Alias)
+	case !alarm.Active && alarm.Failures >= atLeastOne(p.FireAfter):
 		log.Warn("The alert should be active")
-		newActive = true
-		if !alarm.Active {
-			log.Info("The alert was not active before. Let's send the notification")
-			alarm.LastActive = alarm.LastCheck
-			alarm.LastActive.Valid = true
-			err := SendNotification(alarm.Alias, alarm.Recipient, alarm.Name, alarm.Parameter)
-			if err != nil {
+		log.Info("The alert was not active before. Let's send the notification")
+		alarm.Active = true
+		alarm.LastActive = alarm.LastCheck
+		state = "firing"
+	case alarm.Active && alarm.Failures > 0 && alarm.LastActive.Valid &&
+		(!alarm.LastNotification.Valid || alarm.LastNotification.Time.Before(alarm.LastActive.Time)):
+		log.Info("The alert fired without being notified, probably while silenced. Let's send the notification")
+		state = "firing"
+	case alarm.Active && alarm.Failures > 0 && p.Renotify > 0 &&
+		(!alarm.LastNotification.Valid || now.Sub(alarm.LastNotification.Time) >= time.Duration(p.Renotify)*time.Minute):
+		log.Infof("The alert is still active after %v minutes. Let's remind the recipient", p.Renotify)
+		state = "firing"
+	case alarm.Active && alarm.Successes >= atLeastOne(p.ResolveAfter):
+		alarm.Active = false
+		if p.SkipResolved {
+			log.Info("The alert is resolved, the resolved notifications are disabled")
+			break
+		}
+		log.Info("The alert is resolved. Let's send the notification")
+		state = "resolved"
+	}
+	alarm.State = ermis.AlarmState(alarm.Active)
+	if result == ermis.StateUnknown {
+		alarm.State = ermis.StateUnknown
+	}
+	if alarm.State != previous {
+		event = transition(alarm, previous, observed, silenced)
+	}
+	return alarm, event, state
+}
+
+//pending packages the evaluation of an alarm. The notification that is due is recorded, unless the alarm is silenced
+func pending(alarm ermis.Alarm, event *ermis.AlarmEvent, state string, silenced bool) evaluation {
+	if state != "" && !silenced {
+		alarm.LastNotification = alarm.LastCheck
+	}
+	return evaluation{alarm: alarm, event: event, state: state, silenced: silenced}
+}
+
+//notifyRecipients sends the notifications that are due, once the evaluations are stored
+func notifyRecipients(results []evaluation) {
+	for _, r := range results {
+		if r.state != "" && r.silenced {
+			log.Infof("The alert %v on %v is silenced, the %v notification is not sent", r.alarm.Name, r.alarm.Alias, r.state)
+		} else if r.state != "" {
+			if err := SendNotification(r.alarm.Alias, r.alarm.Recipient, r.alarm.Name, r.alarm.Parameter, r.state); err != nil {
 				log.Error(err)
 			}
 		}
 	}
+}
 
-	if alarm.LastActive.Valid {
-		err = db.GetConn().Model(&alarm).Updates(ermis.Alarm{
-			Active:     newActive,
-			LastActive: alarm.LastActive,
-			LastCheck:  alarm.LastCheck}).Error
-	} else {
-		err = db.GetConn().Model(&alarm).Updates(ermis.Alarm{
-			Active:    newActive,
-			LastCheck: alarm.LastCheck}).Error
+//transition describes the state change of an alarm for its history
+func transition(alarm ermis.Alarm, previous string, observed int, silenced bool) *ermis.AlarmEvent {
+	return &ermis.AlarmEvent{
+		AlarmID:  alarm.ID,
+		Alias:    alarm.Alias,
+		Name:     alarm.Name,
+		Time:     alarm.LastCheck.Time,
+		OldState: previous,
+		NewState: alarm.State,
+		Value:    observed,
+		Silenced: silenced,
 	}
-	return err
 }
 
-//SendNotification sends an e-mail to the recipient when alarm is triggered
-func SendNotification(alias, recipient, name string, parameter int) error {
-	log.Infof("Sending a notification to %v that the alert %s on %s has been triggered (less than %d nodes)", recipient, alias, name, parameter)
-	msg := []byte("To: " + recipient + "\r\n" +
-		fmt.Sprintf("Subject: Alert on the alias %s: only %d hosts\r\n\r\nThe alert %s (%d) on %s has been triggered", alias, parameter, name, parameter, alias))
-	err := smtp.SendMail("localhost:25",
-		nil,
-		"lbd@cern.ch",
-		[]string{recipient},
-		msg)
-	return err
+//saveEvaluations stores the state of the alarms and their transitions in a single transaction
+func saveEvaluations(results []evaluation) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var events []ermis.AlarmEvent
+	return db.GetConn().Transaction(func(tx *gorm.DB) error {
+		for _, r := range results {
+			if err := tx.Model(&r.alarm).
+				Select("active", "state", "failures", "successes", "last_check", "last_active", "last_notification").
+				Updates(r.alarm).Error; err != nil {
+				return fmt.Errorf("failed to update the alarm %v on %v: %v", r.alarm.Name, r.alarm.Alias, err)
+			}
+			if r.event != nil {
+				events = append(events, *r.event)
+			}
+		}
+		if len(events) > 0 {
+			if err := tx.CreateInBatches(&events, 100).Error; err != nil {
+				return fmt.Errorf("failed to record the transitions of the alarms: %v", err)
+			}
+		}
+		return nil
+	})
+}
 
+//atLeastOne treats the unset thresholds of the policy as a single check
+func atLeastOne(threshold int) int {
+	if threshold < 1 {
+		return 1
+	}
+	return threshold
 }
 
-func checkAlarm(alias, alert string, parameter int) bool {
-	log.Infof("Checking if the alarm %s %v on %s is active", alert, parameter, alias)
-	if alert == "minimum" {
-		return CheckMinimumAlarm(alias, parameter)
+//SendNotification notifies the recipient when alarm is triggered or resolved, or queues it for the digest
+func SendNotification(alias, recipient, name string, parameter int, state string) error {
+	condition := fmt.Sprintf("%s %d", name, parameter)
+	if checker, found := GetChecker(name); found {
+		condition = checker.Describe(parameter)
+	}
+	n := Notification{
+		Alias:     alias,
+		Alarm:     name,
+		Parameter: parameter,
+		Condition: condition,
+		State:     state,
+		Time:      time.Now(),
 	}
-	log.Errorf("The alert %v (on %v) is not understood!", alert, alias)
-	return true
+	return send(recipient, n)
 }
 
-func getIpsFromDNS(m *dns.Msg, alias, dnsManager string, dnsType uint16, ips *[]net.IP) error {
-	m.SetQuestion(alias+".", dnsType)
-	in, err := dns.Exchange(m, dnsManager+":53")
-	if err != nil {
-		log.Errorf("Error getting the ipv4 state of dns: %v", err)
-		return err
-	}
-	for _, a := range in.Answer {
-		if t, ok := a.(*dns.A); ok {
-			log.Debugf("From %v, got ipv4 %v", t, t.A)
-			*ips = append(*ips, t.A)
-		} else if t, ok := a.(*dns.AAAA); ok {
-			log.Debugf("From %v, got ipv6 %v", t, t.AAAA)
-			*ips = append(*ips, t.AAAA)
+//send queues the notification in the digest of the recipient, or sends it right away if there are no digests
+func send(recipient string, n Notification) error {
+	if digestWindow > 0 {
+		err := enqueue(recipient, n)
+		if err == nil {
+			return nil
 		}
+		log.Errorf("Could not queue the notification, sending it right away: %v", err)
 	}
-	return nil
+	return Notify(recipient, n)
 }
 
-//CheckMinimumAlarm compares the threshold parameter with the number of nodes behind and alias
-func CheckMinimumAlarm(alias string, parameter int) bool {
-	m := new(dns.Msg)
-	var ips []net.IP
-	m.SetEdns0(4096, false)
-	log.Info("Getting the ips from the DNS")
-	err := getIpsFromDNS(m, alias, dnsManager, dns.TypeA, &ips)
-
-	if err != nil {
-		return true
+//checkAlarm returns the state of the alarm on the alias, unknown if its type is not understood
+func checkAlarm(alias ermis.Alias, alert string, parameter int) (string, int) {
+	log.Infof("Checking if the alarm %s %v on %s is active", alert, parameter, alias.AliasName)
+	checker, found := GetChecker(alert)
+	if !found {
+		log.Errorf("The alert %v (on %v) is not understood!", alert, alias.AliasName)
+		return ermis.StateUnknown, 0
 	}
-	err = getIpsFromDNS(m, alias, dnsManager, dns.TypeAAAA, &ips)
+	return checker.Check(alias, parameter)
+}
+
+//CheckMinimumAlarm compares the threshold parameter with the number of nodes behind and alias.
+//It returns the state of the alarm, unknown if the DNS could not be queried
+func CheckMinimumAlarm(alias string, parameter int) string {
+	state, _ := checkMinimum(alias, parameter)
+	return state
+}
+
+//checkMinimum returns the state of the minimum alarm, together with the number of ips of the alias
+func checkMinimum(alias string, parameter int) (string, int) {
+	ips, err := lookupIPs(alias)
 	if err != nil {
-		return true
+		return ermis.StateUnknown, 0
 	}
-	log.Infof("The list of ips : %v\n", ips)
 	if len(ips) < parameter {
 		log.Infof("There are less than %d nodes (only %d)\n", parameter, len(ips))
-		return true
+		return ermis.StateFiring, len(ips)
 	}
 
-	return false
+	return ermis.StateOK, len(ips)
 }
@@ -0,0 +1,226 @@
+package alarms
+
+/*This file contains the registry of alarm types. Every type implements
+the AlarmChecker interface and is registered with its name. The types are
+also made known to ermis, which validates the alarms before storing them*/
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+type (
+	//AlarmChecker evaluates one type of alarm on an alias
+	AlarmChecker interface {
+		//Check returns the state of the alarm(ok, firing or unknown), together with the observed value
+		Check(alias ermis.Alias, parameter int) (string, int)
+		//Schema describes the parameter accepted by the alarm type
+		Schema() ParameterSchema
+		//Describe explains the alarm condition in the notifications
+		Describe(parameter int) string
+	}
+	//ParameterSchema describes the parameter of an alarm type
+	ParameterSchema struct {
+		Description string `json:"description"`
+		Min         int    `json:"min"`
+		Max         int    `json:"max"`
+	}
+	//AlarmType describes a registered alarm type
+	AlarmType struct {
+		Name      string          `json:"name"`
+		Parameter ParameterSchema `json:"parameter"`
+	}
+)
+
+var checkers = make(map[string]AlarmChecker)
+
+func init() {
+	Register("minimum", minimumChecker{})
+	Register("maximum", maximumChecker{})
+	Register("stale_load", staleLoadChecker{})
+	Register("blacklisted_ratio", blacklistedRatioChecker{})
+	Register("dns_mismatch", dnsMismatchChecker{})
+}
+
+//Register adds an alarm type to the registry and makes it valid in ermis
+func Register(name string, checker AlarmChecker) {
+	checkers[name] = checker
+	ermis.RegisterAlarmType(name, checker.Schema().valid)
+}
+
+//GetChecker returns the checker of an alarm type
+func GetChecker(name string) (AlarmChecker, bool) {
+	checker, found := checkers[name]
+	return checker, found
+}
+
+//Types returns the registered alarm types, sorted by name
+func Types() (types []AlarmType) {
+	for name, checker := range checkers {
+		types = append(types, AlarmType{Name: name, Parameter: checker.Schema()})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+//valid returns true if the parameter is within the limits of the schema
+func (s ParameterSchema) valid(parameter int) bool {
+	return parameter >= s.Min && parameter <= s.Max
+}
+
+/*minimum fires when the alias resolves to less hosts than the parameter.
+The observed value is the number of IPs of the alias*/
+type minimumChecker struct{}
+
+func (minimumChecker) Check(alias ermis.Alias, parameter int) (string, int) {
+	return checkMinimum(alias.AliasName, parameter)
+}
+
+func (minimumChecker) Schema() ParameterSchema {
+	return ParameterSchema{Description: "minimum number of hosts in DNS", Min: 0, Max: 1000}
+}
+
+func (minimumChecker) Describe(parameter int) string {
+	return fmt.Sprintf("less than %d hosts", parameter)
+}
+
+/*maximum fires when the alias resolves to more hosts than the parameter.
+The observed value is the number of IPs of the alias*/
+type maximumChecker struct{}
+
+func (maximumChecker) Check(alias ermis.Alias, parameter int) (string, int) {
+	ips, err := lookupIPs(alias.AliasName)
+	if err != nil {
+		return ermis.StateUnknown, 0
+	}
+	if len(ips) > parameter {
+		log.Infof("There are more than %d nodes (%d)", parameter, len(ips))
+		return ermis.StateFiring, len(ips)
+	}
+	return ermis.StateOK, len(ips)
+}
+
+func (maximumChecker) Schema() ParameterSchema {
+	return ParameterSchema{Description: "maximum number of hosts in DNS", Min: 1, Max: 1000}
+}
+
+func (maximumChecker) Describe(parameter int) string {
+	return fmt.Sprintf("more than %d hosts", parameter)
+}
+
+/*stale_load fires when no node of the alias reported its load
+in the last parameter minutes. The observed value is the age in minutes
+of the latest report, or -1 if no node ever reported*/
+type staleLoadChecker struct{}
+
+func (staleLoadChecker) Check(alias ermis.Alias, parameter int) (string, int) {
+	var latest time.Time
+	for _, r := range alias.Relations {
+		if r.LastLoadUpdate.Valid && r.LastLoadUpdate.Time.After(latest) {
+			latest = r.LastLoadUpdate.Time
+		}
+	}
+	if latest.IsZero() {
+		log.Infof("No node of %v ever reported its load", alias.AliasName)
+		return ermis.StateFiring, -1
+	}
+	age := int(time.Since(latest).Minutes())
+	if time.Since(latest) >= time.Duration(parameter)*time.Minute {
+		log.Infof("No node of %v reported its load in the last %d minutes", alias.AliasName, parameter)
+		return ermis.StateFiring, age
+	}
+	return ermis.StateOK, age
+}
+
+func (staleLoadChecker) Schema() ParameterSchema {
+	return ParameterSchema{Description: "minutes without a load report from any node", Min: 1, Max: 10080}
+}
+
+func (staleLoadChecker) Describe(parameter int) string {
+	return fmt.Sprintf("no load report for %d minutes", parameter)
+}
+
+/*blacklisted_ratio fires when more than parameter percent of the nodes are blacklisted.
+The observed value is the percentage of blacklisted nodes*/
+type blacklistedRatioChecker struct{}
+
+func (blacklistedRatioChecker) Check(alias ermis.Alias, parameter int) (string, int) {
+	var blacklisted int
+	if len(alias.Relations) == 0 {
+		return ermis.StateOK, 0
+	}
+	for _, r := range alias.Relations {
+		if r.Blacklist {
+			blacklisted++
+		}
+	}
+	ratio := blacklisted * 100 / len(alias.Relations)
+	if blacklisted*100 > parameter*len(alias.Relations) {
+		log.Infof("%d out of %d nodes of %v are blacklisted", blacklisted, len(alias.Relations), alias.AliasName)
+		return ermis.StateFiring, ratio
+	}
+	return ermis.StateOK, ratio
+}
+
+func (blacklistedRatioChecker) Schema() ParameterSchema {
+	return ParameterSchema{Description: "maximum percentage of blacklisted nodes", Min: 0, Max: 100}
+}
+
+func (blacklistedRatioChecker) Describe(parameter int) string {
+	return fmt.Sprintf("more than %d%% of the nodes blacklisted", parameter)
+}
+
+/*dns_mismatch fires when the alias resolves to more than parameter IPs
+that do not belong to any of its allowed nodes. The observed value is the number of such IPs*/
+type dnsMismatchChecker struct{}
+
+func (dnsMismatchChecker) Check(alias ermis.Alias, parameter int) (string, int) {
+	var allowed []net.IP
+	ips, err := lookupIPs(alias.AliasName)
+	if err != nil {
+		return ermis.StateUnknown, 0
+	}
+	for _, r := range alias.Relations {
+		if r.Blacklist || r.Node == nil {
+			continue
+		}
+		nodeIPs, err := lookupIPs(r.Node.NodeName)
+		if err != nil {
+			return ermis.StateUnknown, 0
+		}
+		allowed = append(allowed, nodeIPs...)
+	}
+	mismatches := 0
+	for _, ip := range ips {
+		if !containsIP(allowed, ip) {
+			log.Infof("The ip %v of %v does not belong to any allowed node", ip, alias.AliasName)
+			mismatches++
+		}
+	}
+	if mismatches > parameter {
+		return ermis.StateFiring, mismatches
+	}
+	return ermis.StateOK, mismatches
+}
+
+func (dnsMismatchChecker) Schema() ParameterSchema {
+	return ParameterSchema{Description: "tolerated number of IPs not belonging to allowed nodes", Min: 0, Max: 1000}
+}
+
+func (dnsMismatchChecker) Describe(parameter int) string {
+	return fmt.Sprintf("more than %d IPs not belonging to allowed nodes", parameter)
+}
+
+//containsIP returns true if the ip is part of the list
+func containsIP(list []net.IP, ip net.IP) bool {
+	for _, v := range list {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
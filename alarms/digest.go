@@ -0,0 +1,104 @@
+package alarms
+
+/*This file contains the digest mode of the notifications. When a digest window
+is configured, the notifications are queued in the DB per recipient. Once the
+oldest notification of a recipient is older than the window, all of them are
+delivered in a single message. The queue survives the restarts of ermis*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+var digestWindow = time.Duration(bootstrap.GetConf().Notifications.DigestWindow) * time.Minute
+
+//enqueue keeps the notification until the digest of the recipient is sent
+func enqueue(recipient string, n Notification) error {
+	queued := ermis.QueuedNotification{
+		Recipient: recipient,
+		Alias:     n.Alias,
+		Alarm:     n.Alarm,
+		Parameter: n.Parameter,
+		Condition: n.Condition,
+		State:     n.State,
+		Time:      n.Time,
+	}
+	log.Infof("Queueing the notification to %v that the alert %s on %s is %s", recipient, n.Alarm, n.Alias, n.State)
+	return db.GetConn().Create(&queued).Error
+}
+
+/*FlushDigests delivers the digests whose window has closed. A recipient with a
+single queued notification receives it as usual. The notifications are removed
+from the queue only once delivered, so the failed digests are retried later*/
+func FlushDigests(now time.Time) error {
+	var (
+		queued []ermis.QueuedNotification
+		errs   []string
+	)
+	if err := db.GetConn().Order("time").Find(&queued).Error; err != nil {
+		return fmt.Errorf("failed to retrieve the queued notifications: %v", err)
+	}
+	perRecipient := make(map[string][]ermis.QueuedNotification)
+	var recipients []string
+	for _, q := range queued {
+		if _, found := perRecipient[q.Recipient]; !found {
+			recipients = append(recipients, q.Recipient)
+		}
+		perRecipient[q.Recipient] = append(perRecipient[q.Recipient], q)
+	}
+	for _, recipient := range recipients {
+		pending := perRecipient[recipient]
+		//They are sorted by time, so the first one opened the window
+		if now.Sub(pending[0].Time) < digestWindow {
+			continue
+		}
+		if err := sendDigest(recipient, pending); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", recipient, err))
+			continue
+		}
+		if err := db.GetConn().Delete(&pending).Error; err != nil {
+			errs = append(errs, fmt.Sprintf("%v: failed to dequeue the notifications: %v", recipient, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to deliver the digests of %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+//sendDigest delivers the queued notifications of a recipient in a single message
+func sendDigest(recipient string, pending []ermis.QueuedNotification) error {
+	var (
+		items   []Notification
+		lines   []string
+		aliases = make(map[string]bool)
+	)
+	for _, q := range pending {
+		items = append(items, Notification{
+			Alias:     q.Alias,
+			Alarm:     q.Alarm,
+			Parameter: q.Parameter,
+			Condition: q.Condition,
+			State:     q.State,
+			Time:      q.Time,
+		})
+		aliases[q.Alias] = true
+		lines = append(lines, fmt.Sprintf("%s %s: %s %s", q.Time.Format("2006-01-02 15:04:05"), q.Alias, q.Condition, q.State))
+	}
+	if len(items) == 1 {
+		return Notify(recipient, items[0])
+	}
+	log.Infof("Sending a digest of %d notifications to %v", len(items), recipient)
+	return deliver(recipient, Notification{
+		State:   "digest",
+		Time:    time.Now(),
+		Subject: fmt.Sprintf("%d alarm notifications on %d aliases", len(items), len(aliases)),
+		Body:    "The following alarms fired or resolved:\n" + strings.Join(lines, "\n"),
+		Items:   items,
+	})
+}
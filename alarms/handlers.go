@@ -0,0 +1,79 @@
+package alarms
+
+/*This file contains the API handlers of the alarms package*/
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+//CheckResult describes the on-demand evaluation of an alarm
+type CheckResult struct {
+	ID            int    `json:"alarm_id"`
+	Name          string `json:"name"`
+	Parameter     int    `json:"parameter"`
+	Result        string `json:"result"`
+	Value         int    `json:"value"`
+	PreviousState string `json:"previous_state"`
+	State         string `json:"state"`
+	Silenced      bool   `json:"silenced"`
+}
+
+//GetAlarmTypes returns the registered alarm types with the schema of their parameter
+func GetAlarmTypes(c echo.Context) error {
+	return c.JSON(http.StatusOK, Types())
+}
+
+/*CheckAlarms evaluates the alarms of an alias right away, instead of waiting for the next round.
+The reply has the result of every check and the state the alarm would have after it.
+With persist=true the new states are stored and the due notifications are sent,
+as in the periodic check*/
+func CheckAlarms(c echo.Context) error {
+	var (
+		replies []CheckResult
+		results []evaluation
+	)
+	persist := c.QueryParam("persist") == "true" || c.FormValue("persist") == "true"
+	alias, status, err := ermis.ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	silences, err := ermis.ActiveSilences(time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Could not retrieve the silences %v", err))
+	}
+
+	startRound()
+	defer endRound()
+	replies = []CheckResult{}
+	for _, alarm := range alias.Alarms {
+		silenced := ermis.Silenced(silences, alias, alarm)
+		result, observed := checkAlarm(alias, alarm.Name, alarm.Parameter)
+		updated, event, state := ApplyPolicy(policy, alarm, result, observed, silenced, time.Now())
+		if persist {
+			results = append(results, pending(updated, event, state, silenced))
+		}
+		replies = append(replies, CheckResult{
+			ID:            alarm.ID,
+			Name:          alarm.Name,
+			Parameter:     alarm.Parameter,
+			Result:        result,
+			Value:         observed,
+			PreviousState: alarm.CurrentState(),
+			State:         updated.State,
+			Silenced:      silenced,
+		})
+	}
+	if persist {
+		log.Infof("[%v] stored the on-demand check of the alarms of %v", ermis.GetUsername(), alias.AliasName)
+		if err := saveEvaluations(results); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to store the alarms: %v", err))
+		}
+		notifyRecipients(results)
+	}
+	return c.JSON(http.StatusOK, replies)
+}
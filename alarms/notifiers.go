@@ -0,0 +1,224 @@
+package alarms
+
+/*This file contains the notification channels of the alarms. Every channel
+implements the Notifier interface and is selected by the scheme of the
+alarm recipient(mailto:, webhook:, mattermost:). Plain addresses are mailed*/
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+)
+
+const (
+	defaultSubject = `{{if eq .State "stale"}}Stale nodes on the alias {{.Alias}}{{else}}{{if eq .State "resolved"}}Resolved{{else}}Alert{{end}} on the alias {{.Alias}}: {{.Condition}}{{end}}`
+	defaultBody    = `{{if eq .State "stale"}}On the alias {{.Alias}}: {{.Condition}}{{else}}The alert {{.Alarm}} ({{.Parameter}}) on {{.Alias}} has been {{if eq .State "resolved"}}resolved{{else}}triggered{{end}}{{end}}`
+)
+
+type (
+	//Notification describes the alarm event delivered to a recipient
+	Notification struct {
+		Alias     string    `json:"alias"`
+		Alarm     string    `json:"alarm"`
+		Parameter int       `json:"parameter"`
+		Condition string    `json:"condition"`
+		State     string    `json:"state"`
+		Time      time.Time `json:"time"`
+		Subject   string    `json:"subject"`
+		Body      string    `json:"body"`
+		//Items are the notifications grouped in a digest
+		Items []Notification `json:"items,omitempty"`
+	}
+	//Notifier delivers a notification to a target of its channel
+	Notifier interface {
+		Notify(target string, n Notification) error
+	}
+	smtpNotifier       struct{}
+	webhookNotifier    struct{}
+	mattermostNotifier struct{}
+)
+
+var (
+	notifiers = map[string]Notifier{
+		"mailto":     smtpNotifier{},
+		"webhook":    webhookNotifier{},
+		"mattermost": mattermostNotifier{},
+	}
+	notifications  = bootstrap.GetConf().Notifications
+	adminRecipient = bootstrap.GetConf().AlarmChecks.AdminRecipient
+	httpClient     = &http.Client{Timeout: 10 * time.Second}
+)
+
+//Notify renders the message of the notification and delivers it to the recipient
+func Notify(recipient string, n Notification) error {
+	var err error
+	if n.Subject, err = render(notifications.Templates.Subject, defaultSubject, n); err != nil {
+		return err
+	}
+	if n.Body, err = render(notifications.Templates.Body, defaultBody, n); err != nil {
+		return err
+	}
+	log.Infof("Sending a notification to %v that the alert %s on %s is %s (%s)", recipient, n.Alarm, n.Alias, n.State, n.Condition)
+	return deliver(recipient, n)
+}
+
+//deliver hands the rendered notification to the notifier of the recipient
+func deliver(recipient string, n Notification) error {
+	channel, target := ermis.ParseRecipient(recipient)
+	notifier, found := notifiers[channel]
+	if !found {
+		return fmt.Errorf("no notifier for the recipient %v", recipient)
+	}
+	return notifier.Notify(target, n)
+}
+
+/*notifyAdmins alerts the ermis admins about the alarms that could not be
+evaluated in this round, instead of their recipients. It sends a single
+message per round and only for the alarms that just became unknown*/
+func notifyAdmins(results []evaluation) error {
+	var lines []string
+	if adminRecipient == "" {
+		return nil
+	}
+	for _, r := range results {
+		if r.event != nil && r.event.NewState == ermis.StateUnknown {
+			lines = append(lines, fmt.Sprintf("%s (%d) on %s", r.alarm.Name, r.alarm.Parameter, r.alarm.Alias))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	log.Infof("Alerting %v that %d alarms could not be evaluated", adminRecipient, len(lines))
+	return deliver(adminRecipient, Notification{
+		State:   ermis.StateUnknown,
+		Time:    time.Now(),
+		Subject: fmt.Sprintf("%d alarms could not be evaluated", len(lines)),
+		Body: "The following alarms could not be evaluated, probably because the DNS did not answer:\n" +
+			strings.Join(lines, "\n"),
+	})
+}
+
+//render executes the configured template, or the default one if none is configured
+func render(text, fallback string, n Notification) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+	t, err := template.New("notification").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the notification template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, n); err != nil {
+		return "", fmt.Errorf("failed to render the notification template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+//Notify mails the notification through the configured server
+func (smtpNotifier) Notify(target string, n Notification) error {
+	conf := notifications.SMTP
+	host, port, sender := conf.Host, conf.Port, conf.Sender
+	if host == "" {
+		host = "localhost"
+	}
+	if port == 0 {
+		port = 25
+	}
+	if sender == "" {
+		sender = "lbd@cern.ch"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	msg := []byte("To: " + target + "\r\n" +
+		"From: " + sender + "\r\n" +
+		"Subject: " + n.Subject + "\r\n\r\n" + n.Body + "\r\n")
+
+	var auth smtp.Auth
+	if conf.Username != "" {
+		auth = smtp.PlainAuth("", conf.Username, conf.Password, host)
+	}
+	if !conf.TLS {
+		//SendMail upgrades the connection with STARTTLS, when the server offers it
+		return smtp.SendMail(addr, auth, sender, []string{target}, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(sender); err != nil {
+		return err
+	}
+	if err = client.Rcpt(target); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+//Notify posts the notification as JSON to the named webhook
+func (webhookNotifier) Notify(target string, n Notification) error {
+	webhook, found := notifications.Webhooks[target]
+	if !found {
+		return fmt.Errorf("webhook %v is not configured", target)
+	}
+	return postJSON(webhook.URL, n)
+}
+
+//Notify posts the message to the named Mattermost/Slack incoming webhook
+func (mattermostNotifier) Notify(target string, n Notification) error {
+	webhook, found := notifications.Mattermost[target]
+	if !found {
+		return fmt.Errorf("mattermost webhook %v is not configured", target)
+	}
+	return postJSON(webhook.URL, map[string]string{
+		"text": "**" + n.Subject + "**\n" + n.Body,
+	})
+}
+
+//postJSON sends the payload and expects a successful status
+func postJSON(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook replied with status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package alarms
+
+/*This file contains the DNS resolution of the alarms. The queries are sent
+to the configured resolvers in order, with a timeout each, until one answers.
+During a round of checks, the lookups of the same name are made only once*/
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+)
+
+type (
+	//resolver queries the DNS servers in order until one of them answers
+	resolver struct {
+		servers []string
+		client  *dns.Client
+	}
+	//lookupCache shares the lookups of the same name between the checks of a round
+	lookupCache struct {
+		sync.Mutex
+		entries map[string]*lookup
+	}
+	//lookup is the result of a lookup, which is ready once done is closed
+	lookup struct {
+		done chan struct{}
+		ips  []net.IP
+		err  error
+	}
+)
+
+var (
+	dnsResolver = newResolver(bootstrap.GetConf().AlarmChecks, bootstrap.GetConf().DNS.Manager)
+	cache       *lookupCache
+	cacheUsers  int
+	cacheMu     sync.Mutex
+)
+
+//newResolver builds the resolver of the config, falling back to the dns manager
+func newResolver(conf bootstrap.AlarmChecks, manager string) *resolver {
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	servers := []string{}
+	for _, s := range conf.Resolvers {
+		if s != "" {
+			servers = append(servers, withPort(s))
+		}
+	}
+	if len(servers) == 0 && manager != "" {
+		servers = append(servers, withPort(manager))
+	}
+	return &resolver{servers: servers, client: &dns.Client{Timeout: timeout}}
+}
+
+//withPort adds the default DNS port to a server without one
+func withPort(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(server, "53")
+}
+
+//exchange sends the question to the servers in order and returns the first answer
+func (r *resolver) exchange(name string, dnsType uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dnsType)
+	m.SetEdns0(4096, false)
+	err := fmt.Errorf("no DNS resolver configured")
+	for _, server := range r.servers {
+		var in *dns.Msg
+		if in, _, err = r.client.Exchange(m, server); err == nil {
+			//A name that does not exist is an answer, a failure of the server is not
+			if in.Rcode == dns.RcodeSuccess || in.Rcode == dns.RcodeNameError {
+				return in, nil
+			}
+			err = fmt.Errorf("the server replied %v", dns.RcodeToString[in.Rcode])
+		}
+		log.Warnf("The DNS server %v did not answer for %v: %v", server, name, err)
+	}
+	return nil, err
+}
+
+//lookupIPs returns the ipv4 and ipv6 addresses of a name
+func (r *resolver) lookupIPs(name string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, dnsType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		in, err := r.exchange(name, dnsType)
+		if err != nil {
+			log.Errorf("Error getting the ips of %v from dns: %v", name, err)
+			return nil, err
+		}
+		for _, a := range in.Answer {
+			if t, ok := a.(*dns.A); ok {
+				log.Debugf("From %v, got ipv4 %v", t, t.A)
+				ips = append(ips, t.A)
+			} else if t, ok := a.(*dns.AAAA); ok {
+				log.Debugf("From %v, got ipv6 %v", t, t.AAAA)
+				ips = append(ips, t.AAAA)
+			}
+		}
+	}
+	log.Debugf("The list of ips of %v: %v", name, ips)
+	return ips, nil
+}
+
+/*startRound shares the lookups between the checks until endRound is called.
+The rounds that overlap, like the periodic and the on-demand checks, share the same lookups*/
+func startRound() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cacheUsers == 0 {
+		cache = &lookupCache{entries: make(map[string]*lookup)}
+	}
+	cacheUsers++
+}
+
+//endRound stops sharing the lookups once the last round ends, so that the next checks see fresh answers
+func endRound() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cacheUsers--
+	if cacheUsers == 0 {
+		cache = nil
+	}
+}
+
+//get returns the lookup of the name, waiting for it if it is already in progress
+func (c *lookupCache) get(name string) ([]net.IP, error) {
+	c.Lock()
+	l, found := c.entries[name]
+	if !found {
+		l = &lookup{done: make(chan struct{})}
+		c.entries[name] = l
+	}
+	c.Unlock()
+	if found {
+		<-l.done
+		return l.ips, l.err
+	}
+	l.ips, l.err = dnsResolver.lookupIPs(name)
+	close(l.done)
+	return l.ips, l.err
+}
+
+//lookupIPs returns the addresses of a name, shared within the current round of checks
+func lookupIPs(name string) ([]net.IP, error) {
+	cacheMu.Lock()
+	c := cache
+	cacheMu.Unlock()
+	if c == nil {
+		return dnsResolver.lookupIPs(name)
+	}
+	return c.get(name)
+}
@@ -0,0 +1,209 @@
+package alarms
+
+/*This file detects the nodes that stopped reporting their load. A node is stale
+when its last report is older than the stale period of its alias. Optionally,
+the stale nodes are blacklisted until they report again. The alarm recipients
+of the alias are told about the nodes that became stale or recovered, like for
+the alarms: unless their alarm is silenced, and in their digest if there is one*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+var autoBlacklist = bootstrap.GetConf().StaleNodes.AutoBlacklist
+
+//staleness holds the nodes of an alias that changed state in this round
+type staleness struct {
+	alias     ermis.Alias
+	stale     []ermis.Relation
+	recovered []ermis.Relation
+}
+
+//CheckStaleNodes flags the nodes that stopped reporting and clears the ones that report again
+func CheckStaleNodes() error {
+	var (
+		aliases []ermis.Alias
+		changes []staleness
+	)
+	if err := db.GetConn().Preload("Relations.Node").Preload("Alarms").Find(&aliases).Error; err != nil {
+		return fmt.Errorf("could not retrieve the nodes of the aliases: %v", err)
+	}
+	now := time.Now()
+	for _, alias := range aliases {
+		if change := staleTransitions(alias, now); len(change.stale)+len(change.recovered) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	changes, err := saveStaleness(changes)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	silences, err := ermis.ActiveSilences(now)
+	if err != nil {
+		log.Errorf("Could not retrieve the silences, the stale nodes are notified anyway: %v", err)
+	}
+	for _, change := range changes {
+		log.Infof("%d nodes of %v became stale and %d recovered", len(change.stale), change.alias.AliasName, len(change.recovered))
+		notifyStaleness(change, silences, now)
+	}
+	return nil
+}
+
+/*staleTransitions finds the nodes of the alias that became stale or recovered.
+The recovered nodes lose the blacklist they got automatically, while the new stale
+ones are blacklisted if configured, as long as the alias keeps an allowed node*/
+func staleTransitions(alias ermis.Alias, now time.Time) (change staleness) {
+	change.alias = alias
+	period := ermis.StalePeriod(alias)
+	allowed := 0
+	for _, r := range alias.Relations {
+		if !r.Blacklist {
+			allowed++
+		}
+	}
+	//The recoveries first, so that the nodes they allow again count for the blacklisting
+	for _, r := range alias.Relations {
+		if r.Stale && !r.IsStale(period, now) {
+			r.Stale = false
+			if r.AutoBlacklisted {
+				r.Blacklist = false
+				r.AutoBlacklisted = false
+				allowed++
+			}
+			change.recovered = append(change.recovered, r)
+		}
+	}
+	for _, r := range alias.Relations {
+		if !r.Stale && r.IsStale(period, now) {
+			r.Stale = true
+			if autoBlacklist && !r.Blacklist {
+				if allowed > 1 {
+					r.Blacklist = true
+					r.AutoBlacklisted = true
+					allowed--
+				} else {
+					log.Warnf("Not blacklisting the stale node %v, it is the last allowed node of %v", nodeName(r), alias.AliasName)
+				}
+			}
+			change.stale = append(change.stale, r)
+		}
+	}
+	return change
+}
+
+/*saveStaleness stores the new state of the nodes in a single transaction. A node
+that reported in the meantime is left untouched, the next round will reconsider it.
+It returns the changes restricted to the nodes actually updated*/
+func saveStaleness(changes []staleness) (saved []staleness, err error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	err = db.GetConn().Transaction(func(tx *gorm.DB) error {
+		//update reports whether the conditional update changed the node
+		update := func(r ermis.Relation) (bool, error) {
+			result := tx.Model(&ermis.Relation{}).
+				Where("id = ? AND last_load_update = ?", r.ID, r.LastLoadUpdate).
+				Updates(map[string]interface{}{
+					"stale":            r.Stale,
+					"blacklist":        r.Blacklist,
+					"auto_blacklisted": r.AutoBlacklisted,
+				})
+			return result.RowsAffected != 0, result.Error
+		}
+		for _, change := range changes {
+			kept := staleness{alias: change.alias}
+			for _, r := range change.stale {
+				updated, err := update(r)
+				if err != nil {
+					return fmt.Errorf("failed to update the node %v of %v: %v", nodeName(r), change.alias.AliasName, err)
+				}
+				if updated {
+					kept.stale = append(kept.stale, r)
+				}
+			}
+			for _, r := range change.recovered {
+				updated, err := update(r)
+				if err != nil {
+					return fmt.Errorf("failed to update the node %v of %v: %v", nodeName(r), change.alias.AliasName, err)
+				}
+				if updated {
+					kept.recovered = append(kept.recovered, r)
+				}
+			}
+			if len(kept.stale)+len(kept.recovered) > 0 {
+				saved = append(saved, kept)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+/*notifyStaleness tells every alarm recipient of the alias about the nodes, once.
+The recipients whose alarms on the alias are all silenced are skipped*/
+func notifyStaleness(change staleness, silences []ermis.Silence, now time.Time) {
+	n := Notification{
+		Alias:     change.alias.AliasName,
+		Alarm:     "stale",
+		Condition: staleCondition(change),
+		State:     "stale",
+		Time:      now,
+	}
+	notified := map[string]bool{}
+	for _, alarm := range change.alias.Alarms {
+		if notified[alarm.Recipient] || ermis.Silenced(silences, change.alias, alarm) {
+			continue
+		}
+		notified[alarm.Recipient] = true
+		if err := send(alarm.Recipient, n); err != nil {
+			log.Errorf("Could not notify %v about the stale nodes of %v: %v", alarm.Recipient, change.alias.AliasName, err)
+		}
+	}
+}
+
+//staleCondition describes the nodes that became stale or recovered, short enough to be queued in a digest
+func staleCondition(change staleness) string {
+	var parts, stale, recovered []string
+	for _, r := range change.stale {
+		if r.AutoBlacklisted {
+			stale = append(stale, nodeName(r)+" (blacklisted until it reports again)")
+		} else {
+			stale = append(stale, nodeName(r))
+		}
+	}
+	for _, r := range change.recovered {
+		recovered = append(recovered, nodeName(r))
+	}
+	if len(stale) > 0 {
+		parts = append(parts, fmt.Sprintf("no load reported for %v by %s", ermis.StalePeriod(change.alias), strings.Join(stale, ", ")))
+	}
+	if len(recovered) > 0 {
+		parts = append(parts, fmt.Sprintf("load reported again by %s", strings.Join(recovered, ", ")))
+	}
+	condition := strings.Join(parts, "; ")
+	//The condition column of the digest queue holds 255 characters
+	if len(condition) > 255 {
+		condition = condition[:252] + "..."
+	}
+	return condition
+}
+
+func nodeName(r ermis.Relation) string {
+	if r.Node == nil {
+		return fmt.Sprintf("node %d", r.NodeID)
+	}
+	return r.Node.NodeName
+}
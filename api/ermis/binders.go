@@ -5,11 +5,10 @@ data from the Resource struct to the ORM one(and vice versa)
 This is done to allow a more Object oriented experience later on */
 import (
 	"database/sql"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/labstack/echo/v4"
 )
 
 /* Resource struct facilitates the binding of data from requests
@@ -41,6 +40,11 @@ type (
 		ResourceURI      string    `json:"resource_uri"      `
 		Pwned            bool      `json:"pwned"             `
 		Alarms           []string  `json:"alarms"            form:"alarms"`
+		//LegacyAuth accepts the lbclient reports with the plain secret, besides the signed ones
+		LegacyAuth *bool `json:"legacy_auth"`
+		//StalePeriod is the time in minutes without reports before a node is stale, 0 uses the default
+		StalePeriod int      `json:"stale_period"`
+		StaleNodes  []string `json:"stale_nodes"`
 	}
 	//Objects holds multiple result structs
 	Objects struct {
@@ -50,9 +54,8 @@ type (
 
 /*sanitazeInCreation stretches the freshly binded data into
 the ORM models, giving us a more appropriate object to work on*/
-func sanitazeInCreation(c echo.Context, resource Resource) (object Alias) {
+func sanitazeInCreation(contentType string, resource Resource) (object Alias) {
 
-	contentType := c.Request().Header.Get("Content-Type")
 	//Cnames
 	object.Cnames = []Cname{}
 	if len(resource.Cnames) != 0 {
@@ -64,11 +67,7 @@ func sanitazeInCreation(c echo.Context, resource Resource) (object Alias) {
 	}
 
 	//Alias name hydration
-	if !strings.HasSuffix(resource.AliasName, ".cern.ch") {
-		object.AliasName = resource.AliasName + ".cern.ch"
-	} else {
-		object.AliasName = resource.AliasName
-	}
+	object.AliasName = FullAliasName(resource.AliasName)
 
 	if resource.Hostgroup != "" {
 		object.Hostgroup = resource.Hostgroup
@@ -78,6 +77,14 @@ func sanitazeInCreation(c echo.Context, resource Resource) (object Alias) {
 	if resource.BestHosts != 0 {
 		object.BestHosts = resource.BestHosts
 	}
+	if resource.StalePeriod > 0 {
+		object.StalePeriod = resource.StalePeriod
+	}
+	//The plain secret is accepted unless the owner disables it
+	object.LegacyAuth = true
+	if resource.LegacyAuth != nil {
+		object.LegacyAuth = *resource.LegacyAuth
+	}
 	//View
 	if StringInSlice(strings.ToLower(resource.External), []string{"yes", "external"}) {
 		object.External = "yes"
@@ -134,6 +141,9 @@ func parse(queryResults []Alias) Objects {
 		temp.ResourceURI = "/p/api/v1/alias/" + strconv.Itoa(element.ID)
 		temp.User = element.User
 		temp.Statistics = element.Statistics
+		legacy := element.LegacyAuth
+		temp.LegacyAuth = &legacy
+		temp.StalePeriod = element.StalePeriod
 
 		//The cnames
 		temp.Cnames = []string{}
@@ -163,6 +173,7 @@ func parse(queryResults []Alias) Objects {
 		//The nodes
 		temp.ForbiddenNodes = []string{}
 		temp.AllowedNodes = []string{}
+		temp.StaleNodes = []string{}
 		if len(element.Relations) != 0 {
 			for _, v := range element.Relations {
 				nameload := v.Node.NodeName + ":" + strconv.Itoa(v.Load) + ":"
@@ -176,6 +187,9 @@ func parse(queryResults []Alias) Objects {
 				} else {
 					temp.AllowedNodes = append(temp.AllowedNodes, nameload)
 				}
+				if v.Stale {
+					temp.StaleNodes = append(temp.StaleNodes, v.Node.NodeName)
+				}
 
 			}
 
@@ -197,8 +211,7 @@ func parse(queryResults []Alias) Objects {
 
 /*sanitazeInUpdate generates the ORM model of an alias from
 the binded request data*/
-func sanitazeInUpdate(c echo.Context, current Alias, new Resource) (Alias, error) {
-	contentType := c.Request().Header.Get("Content-Type")
+func sanitazeInUpdate(contentType string, current Alias, new Resource) (Alias, error) {
 	//Cnames
 	current.Cnames = []Cname{}
 	if len(new.Cnames) != 0 {
@@ -217,15 +230,18 @@ func sanitazeInUpdate(c echo.Context, current Alias, new Resource) (Alias, error
 	if len(new.Alarms) != 0 {
 		split := Explode(contentType, new.Alarms)
 		for _, alarm := range split {
-			element := DeleteEmpty(strings.Split(alarm, ":"))
+			name, recipient, parameter, ok := SplitAlarm(alarm)
+			if !ok {
+				return Alias{}, fmt.Errorf("malformed alarm %v, expected name:recipient:parameter", alarm)
+			}
 			//Convert param from string to int
-			param, err := strconv.Atoi(element[2])
+			param, err := strconv.Atoi(parameter)
 			if err != nil {
 				return Alias{}, err
 			}
 			current.Alarms = append(current.Alarms, Alarm{
-				Name:         element[0],
-				Recipient:    element[1],
+				Name:         name,
+				Recipient:    recipient,
 				Parameter:    param,
 				AlarmAliasID: current.ID,
 				Alias:        current.AliasName})
@@ -288,6 +304,12 @@ func sanitazeInUpdate(c echo.Context, current Alias, new Resource) (Alias, error
 	if new.TTL != 0 {
 		current.TTL = new.TTL
 	}
+	if new.StalePeriod > 0 {
+		current.StalePeriod = new.StalePeriod
+	}
+	if new.LegacyAuth != nil {
+		current.LegacyAuth = *new.LegacyAuth
+	}
 
 	return current, nil
 }
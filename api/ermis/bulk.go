@@ -0,0 +1,325 @@
+package ermis
+
+/*This file contains the bulk endpoint, which applies a list of
+create/patch/delete operations on many aliases within one request.
+Every alias of the request is retrieved from the DB with a single query and
+every operation is authorized, sanitized and validated before anything is applied.
+The DB part of the valid operations is applied in a single transaction, then
+every operation is completed in DNS and tbag.
+In atomic mode nothing is applied unless all operations are valid, the transaction
+is rolled back if one of them fails in DB, and the applied operations are rolled back
+if one of them fails in DNS or tbag. In best_effort mode every operation runs in a
+savepoint of the transaction and is completed independently*/
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/auth"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	landbsoap "gitlab.cern.ch/lb-experts/goermis/landb"
+	"gorm.io/gorm"
+)
+
+const (
+	atomicMode     = "atomic"
+	bestEffortMode = "best_effort"
+)
+
+type (
+	//Operation describes a single action of a bulk request
+	Operation struct {
+		Action string   `json:"action"`
+		Alias  Resource `json:"alias"`
+	}
+	//BulkRequest describes the body of a bulk request
+	BulkRequest struct {
+		Mode       string      `json:"mode"`
+		Operations []Operation `json:"operations"`
+	}
+	//OperationResult reports the outcome of a single operation
+	OperationResult struct {
+		Action    string `json:"action"`
+		AliasName string `json:"alias_name"`
+		Status    int    `json:"status"`
+		Message   string `json:"message"`
+	}
+	//BulkResponse holds the results of all the operations of a bulk request
+	BulkResponse struct {
+		Mode    string            `json:"mode"`
+		Results []OperationResult `json:"results"`
+	}
+	//plannedOperation keeps the prepared objects of a valid operation until it is applied
+	plannedOperation struct {
+		index     int
+		action    string
+		alias     Alias
+		retrieved Alias
+		secret    string
+	}
+)
+
+//BulkAliases applies a list of create/patch/delete operations and reports per operation
+func BulkAliases(c echo.Context) error {
+	var (
+		request BulkRequest
+		names   []string
+	)
+	username := GetUsername()
+
+	/******bind request data*******/
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to bind the bulk request: %v", err))
+	}
+	defer c.Request().Body.Close()
+
+	if request.Mode == "" {
+		request.Mode = atomicMode
+	}
+	if !StringInSlice(request.Mode, []string{atomicMode, bestEffortMode}) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("unknown mode %v, expected %v or %v", request.Mode, atomicMode, bestEffortMode))
+	}
+	if len(request.Operations) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no operations provided")
+	}
+	log.Infof("[%v] received a bulk request with %v operations in %v mode",
+		username, len(request.Operations), request.Mode)
+
+	/******retrieve every alias of the request with a single query******/
+	for i := range request.Operations {
+		request.Operations[i].Alias.AliasName = FullAliasName(request.Operations[i].Alias.AliasName)
+		names = append(names, request.Operations[i].Alias.AliasName)
+	}
+	retrieved, err := GetObjectsByName(names)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	existing := make(map[string]Alias)
+	for _, alias := range retrieved {
+		existing[alias.AliasName] = alias
+	}
+
+	/******authorize, sanitize and validate every operation******/
+	response := BulkResponse{Mode: request.Mode}
+	plans, failed := PlanOperations(request.Operations, existing, &response)
+
+	if failed && request.Mode == atomicMode {
+		skipPending(&response, "not applied, another operation of the request is invalid")
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	/******apply the DB part of the valid operations in a single transaction******/
+	err = db.GetConn().Transaction(func(tx *gorm.DB) error {
+		for _, p := range plans {
+			//every operation runs in a savepoint, a failed one leaves the others intact
+			if err := withinTransaction(tx, p.applyInDB); err != nil {
+				failed = true
+				result := &response.Results[p.index]
+				result.Status, result.Message = http.StatusBadRequest, err.Error()
+				if request.Mode == atomicMode {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if request.Mode == atomicMode {
+			skipPending(&response, "not applied, another operation of the request failed")
+		} else {
+			skipPending(&response, fmt.Sprintf("not applied, the transaction failed: %v", err))
+		}
+		log.Errorf("[%v] bulk request rolled back in the database: %v", username, err)
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	/******complete the operations in DNS and tbag******/
+	var applied []plannedOperation
+	for i, p := range plans {
+		result := &response.Results[p.index]
+		if result.Status != 0 {
+			//failed in DB, in best_effort mode
+			continue
+		}
+		if request.Mode == atomicMode && p.action == "delete" {
+			//keep the secret, so that a rolled back alias can still be updated by its nodes
+			p.secret = auth.GetSecret(p.retrieved.AliasName)
+		}
+		status, err := p.complete()
+		result.Status = status
+		if err != nil {
+			//the failed operation rolls back its own changes
+			failed = true
+			result.Message = err.Error()
+			if request.Mode == atomicMode {
+				reverted := rollbackOperations(applied, true, &response) +
+					rollbackOperations(plans[i+1:], false, &response)
+				skipPending(&response, "not applied, another operation of the request failed")
+				log.Errorf("[%v] bulk request stopped at operation %v, %v other operations rolled back",
+					username, i, reverted)
+				return c.JSON(http.StatusBadRequest, response)
+			}
+			continue
+		}
+		result.Message = "applied successfully"
+		applied = append(applied, p)
+	}
+
+	if failed {
+		return c.JSON(http.StatusMultiStatus, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+//PlanOperations prepares every operation and records the ones that cannot be applied
+func PlanOperations(operations []Operation, existing map[string]Alias, response *BulkResponse) (plans []plannedOperation, failed bool) {
+	seen := make(map[string]bool)
+	for i, op := range operations {
+		name := op.Alias.AliasName
+		response.Results = append(response.Results, OperationResult{
+			Action:    op.Action,
+			AliasName: name})
+		result := &response.Results[len(response.Results)-1]
+
+		status, err := func() (int, error) {
+			if seen[name] {
+				return http.StatusConflict, fmt.Errorf("alias %v appears more than once in the request", name)
+			}
+			seen[name] = true
+			retrieved, found := existing[name]
+
+			switch op.Action {
+			case "create":
+				if found {
+					return http.StatusConflict, fmt.Errorf("the alias already exist in the database")
+				}
+				if len(landbsoap.Conn().DNSDelegatedSearch(strings.Split(name, ".")[0]+"*")) != 0 {
+					return http.StatusConflict, fmt.Errorf("the alias already exist in lanDB")
+				}
+				if !isAuthorized("POST", op.Alias.Hostgroup, "") {
+					return http.StatusUnauthorized,
+						fmt.Errorf("%v is unauthorized to POST in hostgroup %v", GetUsername(), op.Alias.Hostgroup)
+				}
+				alias, err := prepareCreation("application/json", op.Alias)
+				if err != nil {
+					return http.StatusBadRequest, err
+				}
+				plans = append(plans, plannedOperation{index: i, action: op.Action, alias: alias})
+
+			case "patch":
+				if !found {
+					return http.StatusNotFound, fmt.Errorf("the alias does not exist")
+				}
+				if !isAuthorized("PATCH", op.Alias.Hostgroup, retrieved.Hostgroup) {
+					return http.StatusUnauthorized,
+						fmt.Errorf("%v is unauthorized to PATCH in hostgroup %v", GetUsername(), retrieved.Hostgroup)
+				}
+				alias, err := prepareModification("application/json", retrieved, op.Alias)
+				if err != nil {
+					return http.StatusBadRequest, err
+				}
+				plans = append(plans, plannedOperation{index: i, action: op.Action, alias: alias, retrieved: retrieved})
+
+			case "delete":
+				if !found {
+					return http.StatusNotFound, fmt.Errorf("alias not found")
+				}
+				if !isAuthorized("DELETE", "", retrieved.Hostgroup) {
+					return http.StatusUnauthorized,
+						fmt.Errorf("%v is unauthorized to DELETE from hostgroup %v", GetUsername(), retrieved.Hostgroup)
+				}
+				plans = append(plans, plannedOperation{index: i, action: op.Action, retrieved: retrieved})
+
+			default:
+				return http.StatusBadRequest, fmt.Errorf("unknown action %v, expected create, patch or delete", op.Action)
+			}
+			return 0, nil
+		}()
+
+		if err != nil {
+			failed = true
+			result.Status = status
+			result.Message = err.Error()
+			log.Warnf("[%v] bulk operation %v on %v rejected: %v", GetUsername(), op.Action, name, err)
+		}
+	}
+	return plans, failed
+}
+
+//applyInDB runs the DB part of a planned operation with conn
+func (p plannedOperation) applyInDB(conn *gorm.DB) error {
+	switch p.action {
+	case "create":
+		return p.alias.createObjectInDB(conn)
+	case "patch":
+		return p.alias.updateInDB(conn)
+	default:
+		return p.retrieved.deleteObjectInDB(conn)
+	}
+}
+
+//complete runs the DNS and tbag part of a planned operation, once its DB part is committed
+func (p plannedOperation) complete() (int, error) {
+	switch p.action {
+	case "create":
+		return p.alias.completeCreation()
+	case "patch":
+		return p.alias.completeModification(p.retrieved)
+	default:
+		return p.retrieved.completeDeletion()
+	}
+}
+
+/*rollbackOperations reverts the operations of an atomic request, newest first.
+The completed ones are reverted in DNS and tbag too, the others only in DB.
+It returns the number of operations reverted successfully*/
+func rollbackOperations(operations []plannedOperation, completed bool, response *BulkResponse) (reverted int) {
+	for i := len(operations) - 1; i >= 0; i-- {
+		var err error
+		p := operations[i]
+		switch p.action {
+		case "create":
+			if err = p.alias.RollbackInCreate(true, completed); err == nil && completed {
+				err = p.alias.deleteSecret()
+			}
+		case "patch":
+			if err = p.alias.RollbackInModify(p.retrieved); err == nil && completed {
+				err = p.retrieved.updateDNS(p.alias)
+			}
+		case "delete":
+			if err = p.retrieved.RollbackInDelete(true, completed); err == nil && completed && p.secret != "" {
+				err = auth.PostSecret(p.retrieved.AliasName, p.secret)
+			}
+		}
+		result := &response.Results[p.index]
+		if err != nil {
+			if !completed {
+				result.Status = http.StatusInternalServerError
+				result.Message = fmt.Sprintf("applied in the database only, but the rollback failed: %v", err)
+			} else {
+				result.Message = fmt.Sprintf("applied, but the rollback failed: %v", err)
+			}
+			log.Errorf("[%v] failed to roll back bulk operation %v on %v: %v",
+				GetUsername(), p.action, result.AliasName, err)
+			continue
+		}
+		reverted++
+		if completed {
+			result.Message = "rolled back, another operation of the request failed"
+		}
+	}
+	return reverted
+}
+
+//skipPending marks the operations that were neither applied nor rejected
+func skipPending(response *BulkResponse, message string) {
+	for i := range response.Results {
+		if response.Results[i].Status == 0 {
+			response.Results[i].Status = http.StatusFailedDependency
+			response.Results[i].Message = message
+		}
+	}
+}
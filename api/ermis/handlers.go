@@ -129,58 +129,15 @@ func CreateAlias(c echo.Context) error {
 	log.Infof("[%v] duplicate check passed for alias %v",
 		username, temp.AliasName)
 
-	/******sanitaze the binded data into ORM******/
-	alias := sanitazeInCreation(c, temp)
-	log.Infof("[" + username + "] " + "Sanitazed succesfully " + temp.AliasName)
-
-	/******Validate structure******/
-	if ok, err := govalidator.ValidateStruct(alias); err != nil || !ok {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("validation error for %v: %v", temp.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] validation passed for alias %v",
-		username, temp.AliasName)
-
-	/******Create object in DB******/
-	if err := alias.createObjectInDB(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("creation error for %v: %v", temp.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] created %v in database, now creating in DNS  ",
-		username, alias.AliasName)
-
-	/******Create in DNS******/
-	if err := alias.createInDNS(); err != nil {
-
-		log.Errorf("[%v] failed to create entry in DNS, initiating rollback for alias %v\nError:%v",
-			alias.User, alias.AliasName, err)
-
-		//rollback only DB , after failed DNS creation
-		err := alias.RollbackInCreate(true, false)
-		if err != nil {
-			return MessageToUser(c, http.StatusBadRequest,
-				fmt.Sprint(err), "home.html")
-
-		}
-
-		//on successful rollback
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("failed to create alias %v in DNS, database rolled back", alias.AliasName), "home.html")
-
+	/******sanitaze the binded data into ORM and validate******/
+	alias, err := prepareCreation(c.Request().Header.Get("Content-Type"), temp)
+	if err != nil {
+		return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
 	}
 
-	/******Create secret in tbag******/
-	if err := alias.createSecret(); err != nil {
-		log.Errorf("[%v] failed to create secret in tbag for alias %v, initiating rollback\nerror:%v",
-			alias.User, alias.AliasName, err)
-
-		//rollback db and dns after failed secret creation
-		err := alias.RollbackInCreate(true, true)
-		if err != nil {
-			return MessageToUser(c, http.StatusBadRequest,
-				fmt.Sprint(err), "home.html")
-		}
-
+	/******Create in DB, DNS and tbag******/
+	if status, err := alias.applyCreation(); err != nil {
+		return MessageToUser(c, status, err.Error(), "home.html")
 	}
 
 	/******Success message******/
@@ -227,39 +184,9 @@ func DeleteAlias(c echo.Context) error {
 	log.Infof("[%v] retrieved alias %v from database, ready to delete it",
 		username, aliasToDelete)
 
-	/******delete from db******/
-	if err := alias[0].deleteObjectInDB(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
-
-	}
-	log.Infof("[%v] deleted from the database, now deleting from the DNS %v",
-		username, aliasToDelete)
-
-	/******Now delete from DNS******/
-	if err := alias[0].deleteFromDNS(); err != nil {
-		log.Errorf("[%v] something went wrong while deleting %v from DNS, initiating the rollback",
-			username, aliasToDelete)
-
-		//rollback db deletion
-		if err := alias[0].RollbackInDelete(true, false); err != nil {
-			return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
-
-		}
-	}
-
-	/******Delete secret from tbag******/
-	if len(auth.GetSecret(alias[0].AliasName)) != 0 {
-
-		if err := alias[0].deleteSecret(); err != nil {
-			log.Errorf("[%v] failed to delete the secret from tbag for alias %v, initiating the rollback",
-				username, aliasToDelete)
-
-			//rollback db and dns deletions
-			if err := alias[0].RollbackInDelete(true, true); err != nil {
-				return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
-
-			}
-		}
+	/******delete from db, DNS and tbag******/
+	if status, err := alias[0].applyDeletion(); err != nil {
+		return MessageToUser(c, status, err.Error(), "home.html")
 	}
 
 	/******tres bien******/
@@ -305,73 +232,16 @@ func ModifyAlias(c echo.Context) error {
 	log.Infof("[%v] existance check passed and retrieved existing data for %v",
 		username, temp.AliasName)
 
-	/******sanitaze incoming data into ORM before updating******/
-	alias, err := sanitazeInUpdate(c, retrieved[0], temp)
+	/******sanitaze incoming data into ORM and validate before updating******/
+	alias, err := prepareModification(c.Request().Header.Get("Content-Type"), retrieved[0], temp)
 	if err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("failed to sanitize %v: %v ", temp.AliasName, err), "home.html")
-
+		return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
 	}
 	defer c.Request().Body.Close()
-	log.Infof("[%v] sanitized successfully %v",
-		username, temp.AliasName)
-
-	/******Validate object ******/
-	if ok, err := govalidator.ValidateStruct(alias); err != nil || !ok {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("validation error for alias %v: %v", temp.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] validation check passed for %v",
-		username, temp.AliasName)
 
-	/****** Update alias fields(hg, external, best hosts etc.) ******/
-	if err := alias.updateAlias(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("update error for alias %v: %v ", alias.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] updated alias %v, now will check his associations", username, alias.AliasName)
-
-	/****** Update the cnames ******/
-	if err := alias.updateCnames(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("update error for alias %v: %v ", alias.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] finished the cnames update for %v",
-		username, temp.AliasName)
-
-	/****** Update the nodes ******/
-	if err := alias.updateNodes(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("update error for alias %v: %v ", alias.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] finished the nodes update for %v ",
-		username, temp.AliasName)
-
-	/****** Update the alarms ******/
-	if err := alias.updateAlarms(); err != nil {
-		return MessageToUser(c, http.StatusBadRequest,
-			fmt.Sprintf("update error for alias %v: %v ", alias.AliasName, err), "home.html")
-	}
-	log.Infof("[%v] the database was updated successfully, now we can update the DNS", username)
-
-	/****** Update in DNS ******/
-	if err = alias.updateDNS(retrieved[0]); err != nil {
-		//If something goes wrong while updating, then we use the object
-		//we had in DB before the update to restore that state, before the error
-
-		log.Errorf("[%v] could not update %v  in DNS, starting the rollback procedure",
-			username, alias.AliasName)
-
-		/******Rollback******/
-		err := alias.RollbackInModify(retrieved[0])
-		if err != nil {
-			return MessageToUser(c, http.StatusAccepted,
-				fmt.Sprintf("%v", err), "home.html")
-
-		}
-		/******Successful rollback message******/
-		return MessageToUser(c, http.StatusAccepted,
-			fmt.Sprintf("rolled back to previous state completed for alias %v	, please try again later or contact admin", alias.AliasName), "home.html")
+	/****** Update in DB and DNS ******/
+	if status, err := alias.applyModification(retrieved[0]); err != nil {
+		return MessageToUser(c, status, err.Error(), "home.html")
 	}
 
 	/****** Success message ******/
@@ -406,7 +276,7 @@ func PurgeAlias(c echo.Context) error {
 	}
 
 	/******Delete from ermisdb without asking questions/complains******/
-	dberr := alias.deleteObjectInDB()
+	dberr := alias.deleteObjectInDB(db.GetConn())
 	if dberr != nil {
 		log.Errorf("[%v]delete from database alias %v [ERROR]  %v\n", username, aliasToDelete, dberr.Error())
 	} else {
@@ -459,7 +329,7 @@ func PurgeCname(c echo.Context) error {
 	}
 	log.Infof("[%v]retrieved current state from the database", username)
 	/******sanitaze incoming data into ORM before updating******/
-	alias, err := sanitazeInUpdate(c, currentstate[0], temp)
+	alias, err := sanitazeInUpdate(c.Request().Header.Get("Content-Type"), currentstate[0], temp)
 	if err != nil {
 		log.Errorf("failed to sanitize %v: %v\n", temp.AliasName, err)
 
@@ -480,7 +350,7 @@ func PurgeCname(c echo.Context) error {
 	}
 
 	/****** Update the cnames ******/
-	if err := alias.updateCnames(); err != nil {
+	if err := alias.updateCnames(db.GetConn()); err != nil {
 		log.Errorf("[%v] update error for alias %v: %v\n", username, alias.AliasName, err)
 	} else {
 		log.Info("update cnames in database [OK]\n")
@@ -2,9 +2,9 @@ package ermis
 
 /* This file contains helper functions and custom validator tags*/
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
-	"math/rand"
 	"regexp"
 	"strconv"
 	"strings"
@@ -50,6 +50,14 @@ func Explode(contentType string, slice []string) []string {
 
 }
 
+//FullAliasName appends the domain to an alias name, if it is missing
+func FullAliasName(name string) string {
+	if !strings.HasSuffix(name, ".cern.ch") {
+		return name + ".cern.ch"
+	}
+	return name
+}
+
 //FindNodeID returns the ID of a node. If it doesnt exists, returns 0
 func FindNodeID(name string, relations []Relation) int {
 	for _, n := range relations {
@@ -99,15 +107,13 @@ func EqualCnames(cname1, cname2 []Cname) bool {
 	return true
 }
 
-func generateRandomSecret() string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-	s := make([]rune, 10)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
+func generateRandomSecret() (string, error) {
+	//crypto/rand, so that the secrets cannot be predicted
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a random secret: %v", err)
 	}
-
-	secret := base64.StdEncoding.EncodeToString([]byte(string(s)))
-	return secret
+	return base64.StdEncoding.EncodeToString(b), nil
 }
 
 /*//////////////Custom Validator Tags/////////////////////////*/
@@ -154,27 +160,43 @@ func customValidators() {
 	govalidator.TagMap["alarms"] = govalidator.Validator(func(str string) bool {
 
 		if len(str) > 0 {
-			alarm := strings.Split(str, ":")
-			if !StringInSlice(alarm[0], []string{"minimum"}) {
-				log.Error("No valid type of alarm")
+			name, recipient, parameter, ok := SplitAlarm(str)
+			if !ok {
+				log.Errorf("No valid alarm %v", str)
 				return false
 			}
-			if !govalidator.IsEmail(alarm[1]) {
-				log.Errorf("No valid e-mail address %v in alarm %v ", alarm[1], str)
+			if !ValidRecipient(recipient) {
+				log.Errorf("No valid recipient %v in alarm %v ", recipient, str)
 				return false
 
 			}
-			if !govalidator.IsInt(alarm[2]) {
-				log.Errorf("No valid parameter value %v in alarm %v", alarm[2], str)
+			param, err := strconv.Atoi(parameter)
+			if err != nil {
+				log.Errorf("No valid parameter value %v in alarm %v", parameter, str)
 				return false
 
 			}
-			return true
+			return ValidAlarm(name, param)
 		}
 
 		return false
 	})
 
+	govalidator.TagMap["recipient"] = govalidator.Validator(ValidRecipient)
+
+	//alarm validates the type of an Alarm together with its parameter
+	govalidator.CustomTypeTagMap.Set("alarm", govalidator.CustomTypeValidator(func(i interface{}, context interface{}) bool {
+		name, ok := i.(string)
+		if !ok {
+			return false
+		}
+		alarm, ok := context.(Alarm)
+		if !ok {
+			return false
+		}
+		return ValidAlarm(name, alarm.Parameter)
+	}))
+
 	govalidator.TagMap["best_hosts"] = govalidator.Validator(func(str string) bool {
 		param, err := strconv.Atoi(str)
 		if err != nil {
@@ -199,6 +221,65 @@ func customValidators() {
 
 }
 
+/*alarmTypes holds the known types of alarms and the validation of their parameter.
+The alarms package registers its checkers here, since ermis cannot import it*/
+var alarmTypes = map[string]func(parameter int) bool{
+	"minimum": func(parameter int) bool { return parameter >= 0 && parameter <= 1000 },
+}
+
+//RegisterAlarmType makes an alarm type and the validation of its parameter known to ermis
+func RegisterAlarmType(name string, validParameter func(parameter int) bool) {
+	alarmTypes[name] = validParameter
+}
+
+//ValidAlarm returns true if the alarm type is known and its parameter is accepted
+func ValidAlarm(name string, parameter int) bool {
+	validParameter, found := alarmTypes[name]
+	if !found {
+		log.Errorf("No valid type of alarm %v", name)
+		return false
+	}
+	if !validParameter(parameter) {
+		log.Errorf("No valid parameter %v for alarm %v", parameter, name)
+		return false
+	}
+	return true
+}
+
+//SplitAlarm splits an alarm written as name:recipient:parameter. The recipient may contain colons
+func SplitAlarm(str string) (name, recipient, parameter string, ok bool) {
+	element := DeleteEmpty(strings.Split(str, ":"))
+	if len(element) < 3 {
+		return "", "", "", false
+	}
+	return element[0], strings.Join(element[1:len(element)-1], ":"), element[len(element)-1], true
+}
+
+/*ParseRecipient returns the notification channel and the target of an alarm recipient.
+Recipients are written as mailto:<address>, webhook:<name> or mattermost:<name>, while
+a plain address is delivered by mail*/
+func ParseRecipient(recipient string) (channel, target string) {
+	parts := strings.SplitN(recipient, ":", 2)
+	if len(parts) == 2 && StringInSlice(parts[0], []string{"mailto", "webhook", "mattermost"}) {
+		return parts[0], parts[1]
+	}
+	return "mailto", recipient
+}
+
+//ValidRecipient checks the address of the mail recipients and that the webhooks are configured
+func ValidRecipient(recipient string) bool {
+	channel, target := ParseRecipient(recipient)
+	switch channel {
+	case "webhook":
+		_, found := cfg.Notifications.Webhooks[target]
+		return found
+	case "mattermost":
+		_, found := cfg.Notifications.Mattermost[target]
+		return found
+	}
+	return govalidator.IsEmail(target)
+}
+
 /*/////////////Unified way to return responses to user /////////////////////////////*/
 
 //MessageToUser renders the reply for the user
@@ -0,0 +1,261 @@
+package ermis
+
+/*This file contains the load history of the nodes. Every report of the lbclients
+is kept as a raw sample for a while, then averaged over periods of the configured
+resolution. The averaged samples are deleted once the retention expires*/
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+//maxSamples limits the samples of a single query, longer ranges need the averaged samples
+const maxSamples = 100000
+
+type (
+	//LoadSeries is the load of a node in an alias over time
+	LoadSeries struct {
+		AliasName string      `json:"alias_name"`
+		NodeName  string      `json:"node_name"`
+		Points    []LoadPoint `json:"points"`
+	}
+	//LoadPoint is the load of a node at a time
+	LoadPoint struct {
+		Time time.Time `json:"time"`
+		Load int       `json:"load"`
+	}
+)
+
+//RecordLoads stores the loads reported by the nodes
+func RecordLoads(samples []LoadSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if err := db.GetConn().CreateInBatches(&samples, 500).Error; err != nil {
+		return fmt.Errorf("failed to record the load history: %v", err)
+	}
+	return nil
+}
+
+//historyDurations returns the raw retention, the resolution and the retention of the config, or their defaults
+func historyDurations() (raw, resolution, retention time.Duration) {
+	raw, resolution, retention = 24*time.Hour, time.Hour, 30*24*time.Hour
+	if cfg.LoadHistory.Raw > 0 {
+		raw = time.Duration(cfg.LoadHistory.Raw) * time.Hour
+	}
+	if cfg.LoadHistory.Resolution > 0 {
+		resolution = time.Duration(cfg.LoadHistory.Resolution) * time.Minute
+	}
+	if cfg.LoadHistory.Retention > 0 {
+		retention = time.Duration(cfg.LoadHistory.Retention) * 24 * time.Hour
+	}
+	return raw, resolution, retention
+}
+
+/*CompactLoadHistory averages the raw samples older than the raw retention and deletes
+the averaged samples older than the retention. Only whole periods are averaged,
+so that the samples of a period never end up split in two averages*/
+func CompactLoadHistory() error {
+	var averaged []LoadSample
+	raw, resolution, retention := historyDurations()
+	seconds := int64(resolution / time.Second)
+	now := time.Now()
+	cutoff := time.Unix(now.Add(-raw).Unix()/seconds*seconds, 0)
+	period := fmt.Sprintf("FLOOR(UNIX_TIMESTAMP(time) / %d)", seconds)
+
+	return WithinTransaction(func(tx *gorm.DB) (err error) {
+		if err = tx.Model(&LoadSample{}).
+			Select(fmt.Sprintf("alias_id, node_id, FROM_UNIXTIME(%s * %d) AS time, ROUND(AVG(`load`)) AS `load`, %d AS resolution",
+				period, seconds, seconds)).
+			Where("resolution = 0 AND time < ?", cutoff).
+			Group("alias_id, node_id, " + period).
+			Scan(&averaged).Error; err != nil {
+			return fmt.Errorf("failed to average the load history: %v", err)
+		}
+		if len(averaged) > 0 {
+			if err = tx.CreateInBatches(&averaged, 500).Error; err != nil {
+				return fmt.Errorf("failed to store the averaged load history: %v", err)
+			}
+		}
+		if err = tx.Where("resolution = 0 AND time < ?", cutoff).
+			Delete(&LoadSample{}).Error; err != nil {
+			return fmt.Errorf("failed to delete the averaged samples: %v", err)
+		}
+		if err = tx.Where("resolution > 0 AND time < ?", now.Add(-retention)).
+			Delete(&LoadSample{}).Error; err != nil {
+			return fmt.Errorf("failed to delete the expired load history: %v", err)
+		}
+		log.Infof("Averaged the load history before %v in %d samples", cutoff, len(averaged))
+		return nil
+	})
+}
+
+//Downsample averages the points over periods of step, each point taking the start of its period
+func Downsample(points []LoadPoint, step time.Duration) []LoadPoint {
+	var (
+		downsampled []LoadPoint
+		sum, count  int
+	)
+	seconds := int64(step / time.Second)
+	if seconds <= 0 {
+		return points
+	}
+	flush := func(start int64) {
+		if count > 0 {
+			//rounded to the closest integer, like the stored averages
+			downsampled = append(downsampled, LoadPoint{Time: time.Unix(start, 0).UTC(), Load: (2*sum + count) / (2 * count)})
+		}
+		sum, count = 0, 0
+	}
+	current := int64(-1)
+	for _, p := range points {
+		start := p.Time.Unix() / seconds * seconds
+		if start != current {
+			flush(current)
+			current = start
+		}
+		sum += p.Load
+		count++
+	}
+	flush(current)
+	return downsampled
+}
+
+//parseTime reads a time parameter in RFC3339 or YYYY-MM-DD, the fallback is used if missing
+func parseTime(param string, fallback time.Time) (time.Time, error) {
+	if param == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", param); err != nil {
+			return time.Time{}, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, received: %v", param)
+		}
+	}
+	return t, nil
+}
+
+/*loadSeries retrieves the samples matching the query within the range of the request
+(since, until, by default the last 24 hours) and splits them in series of alias and node.
+The step parameter, in seconds, averages the points of each series*/
+func loadSeries(c echo.Context, query *gorm.DB) ([]LoadSeries, int, error) {
+	var (
+		samples []LoadSample
+		aliases []Alias
+		nodes   []Node
+		step    int
+		err     error
+	)
+	now := time.Now()
+	since, err := parseTime(c.QueryParam("since"), now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("wrong since parameter, %v", err)
+	}
+	until, err := parseTime(c.QueryParam("until"), now)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("wrong until parameter, %v", err)
+	}
+	if param := c.QueryParam("step"); param != "" {
+		if step, err = strconv.Atoi(param); err != nil || step < 1 {
+			return nil, http.StatusBadRequest, fmt.Errorf("wrong step parameter, received: %v", param)
+		}
+	}
+	if err = query.Where("time >= ? AND time <= ?", since, until).
+		Order("alias_id, node_id, time").
+		Limit(maxSamples + 1).
+		Find(&samples).Error; err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Failed in query: %v", err)
+	}
+	if len(samples) > maxSamples {
+		return nil, http.StatusBadRequest, fmt.Errorf("more than %d samples in the range, please narrow it", maxSamples)
+	}
+
+	//The names of the aliases and nodes, including the ones no longer related
+	aliasIDs, nodeIDs := map[int]bool{}, map[int]bool{}
+	for _, s := range samples {
+		aliasIDs[s.AliasID], nodeIDs[s.NodeID] = true, true
+	}
+	if len(samples) > 0 {
+		if err = db.GetConn().Select("id, alias_name").Where("id IN ?", keys(aliasIDs)).Find(&aliases).Error; err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Failed in query: %v", err)
+		}
+		if err = db.GetConn().Select("id, node_name").Where("id IN ?", keys(nodeIDs)).Find(&nodes).Error; err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Failed in query: %v", err)
+		}
+	}
+	aliasNames, nodeNames := map[int]string{}, map[int]string{}
+	for _, a := range aliases {
+		aliasNames[a.ID] = a.AliasName
+	}
+	for _, n := range nodes {
+		nodeNames[n.ID] = n.NodeName
+	}
+
+	series := []LoadSeries{}
+	for i, s := range samples {
+		if i == 0 || s.AliasID != samples[i-1].AliasID || s.NodeID != samples[i-1].NodeID {
+			series = append(series, LoadSeries{AliasName: aliasNames[s.AliasID], NodeName: nodeNames[s.NodeID]})
+		}
+		last := &series[len(series)-1]
+		last.Points = append(last.Points, LoadPoint{Time: s.Time, Load: s.Load})
+	}
+	for i := range series {
+		series[i].Points = Downsample(series[i].Points, time.Duration(step)*time.Second)
+	}
+	return series, http.StatusOK, nil
+}
+
+func keys(set map[int]bool) (ids []int) {
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+//GetAliasLoad returns the load history of the nodes of an alias, or of a single one with the node parameter
+func GetAliasLoad(c echo.Context) error {
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	query := db.GetConn().Where("alias_id = ?", retrieved.ID)
+	if name := c.QueryParam("node"); name != "" {
+		query = query.Where("node_id = ?", FindNodeID(name, retrieved.Relations))
+	}
+	series, status, err := loadSeries(c, query)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, series)
+}
+
+//GetNodeLoad returns the load history of a node in every alias, or in a single one with the alias parameter
+func GetNodeLoad(c echo.Context) error {
+	var node Node
+	name, err := validNodeName(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err = db.GetConn().Where("node_name = ?", name).Limit(1).Find(&node).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+	if node.ID == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "node not found")
+	}
+	query := db.GetConn().Where("node_id = ?", node.ID)
+	if aliasname := c.QueryParam("alias"); aliasname != "" {
+		query = query.Where("alias_id IN (?)",
+			db.GetConn().Model(&Alias{}).Select("id").Where("alias_name = ?", FullAliasName(aliasname)))
+	}
+	series, status, err := loadSeries(c, query)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	return c.JSON(http.StatusOK, series)
+}
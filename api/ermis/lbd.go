@@ -0,0 +1,234 @@
+package ermis
+
+/*This file contains the configuration of the load balancing daemon(lbd). Every alias
+is rendered in the format of the lbd configuration file, with its parameters and its
+allowed nodes. The checksum of the configuration is its ETag, so that lbd can poll
+without downloading it again. Every change of the configuration is kept as a new
+generation, so that two generations can be compared when a change goes wrong*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+//LBDGeneration describes a stored generation of the lbd configuration
+type LBDGeneration struct {
+	Generation int       `json:"generation"`
+	Checksum   string    `json:"checksum"`
+	Aliases    int       `json:"aliases"`
+	Created    time.Time `json:"created"`
+}
+
+/*RenderLBDConfig writes the aliases in the format of the lbd configuration file.
+The output only depends on the aliases, so that its checksum changes with them:
+the aliases and their nodes are sorted by name. The blacklisted nodes are left
+out of the clusters, lbd never answers with them, and are listed in a comment*/
+func RenderLBDConfig(aliases []Alias) string {
+	var b strings.Builder
+	sorted := append([]Alias{}, aliases...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].AliasName < sorted[j].AliasName })
+
+	b.WriteString("#lbd configuration generated by ermis, do not edit\n")
+	for _, alias := range sorted {
+		var allowed, forbidden []string
+		for _, r := range alias.Relations {
+			if r.Node == nil {
+				continue
+			}
+			if r.Blacklist {
+				forbidden = append(forbidden, r.Node.NodeName)
+			} else {
+				allowed = append(allowed, r.Node.NodeName)
+			}
+		}
+		sort.Strings(allowed)
+		sort.Strings(forbidden)
+		fmt.Fprintf(&b, "parameters %s = best_hosts#%d external#%s metric#%s polling_interval#%d statistics#%s ttl#%d\n",
+			alias.AliasName, alias.BestHosts, alias.External, alias.Metric, alias.PollingInterval, alias.Statistics, alias.TTL)
+		fmt.Fprintf(&b, "clusters %s = %s\n", alias.AliasName, strings.Join(allowed, " "))
+		if len(forbidden) > 0 {
+			fmt.Fprintf(&b, "#blacklisted %s = %s\n", alias.AliasName, strings.Join(forbidden, " "))
+		}
+	}
+	return b.String()
+}
+
+//Checksum returns the hex SHA-256 of the configuration, which is also its ETag
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+/*DiffConfigs compares two configurations line by line. The lines only found in the
+old one are returned first with a "-", followed by the ones only in the new one with a "+".
+Every alias has its own lines, so this is enough to tell what changed in every alias*/
+func DiffConfigs(previous, current string) []string {
+	diff := []string{}
+	previousLines, currentLines := lineSet(previous), lineSet(current)
+	for _, line := range strings.Split(previous, "\n") {
+		if line != "" && !currentLines[line] {
+			diff = append(diff, "-"+line)
+		}
+	}
+	for _, line := range strings.Split(current, "\n") {
+		if line != "" && !previousLines[line] {
+			diff = append(diff, "+"+line)
+		}
+	}
+	return diff
+}
+
+func lineSet(content string) map[string]bool {
+	set := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		set[line] = true
+	}
+	return set
+}
+
+//currentLBDConfig renders the configuration of all the aliases in the DB
+func currentLBDConfig() (string, int, error) {
+	aliases, err := GetObjects("all")
+	if err != nil {
+		return "", 0, err
+	}
+	return RenderLBDConfig(aliases), len(aliases), nil
+}
+
+//snapshotsOrDefault returns the number of generations kept, 100 by default
+func snapshotsOrDefault() int {
+	if cfg.LBD.Snapshots > 0 {
+		return cfg.LBD.Snapshots
+	}
+	return 100
+}
+
+//SnapshotLBDConfig stores the configuration as a new generation if it changed, then drops the oldest generations
+func SnapshotLBDConfig() error {
+	var latest LBDSnapshot
+	content, aliases, err := currentLBDConfig()
+	if err != nil {
+		return fmt.Errorf("failed to render the lbd configuration: %v", err)
+	}
+	checksum := Checksum(content)
+	return WithinTransaction(func(tx *gorm.DB) (err error) {
+		if err = tx.Order("id desc").Limit(1).Find(&latest).Error; err != nil {
+			return fmt.Errorf("failed to retrieve the latest lbd configuration: %v", err)
+		}
+		if latest.ID != 0 && latest.Checksum == checksum {
+			return nil
+		}
+		snapshot := LBDSnapshot{Checksum: checksum, Content: content, Aliases: aliases, Created: time.Now()}
+		if err = tx.Create(&snapshot).Error; err != nil {
+			return fmt.Errorf("failed to store the lbd configuration: %v", err)
+		}
+		if err = tx.Where("id <= ?", snapshot.ID-snapshotsOrDefault()).
+			Delete(&LBDSnapshot{}).Error; err != nil {
+			return fmt.Errorf("failed to delete the old lbd configurations: %v", err)
+		}
+		log.Infof("Stored the generation %d of the lbd configuration, with %d aliases", snapshot.ID, aliases)
+		return nil
+	})
+}
+
+//serveLBDConfig replies with the configuration, or Not Modified if the client has it already
+func serveLBDConfig(c echo.Context, content string, generation int) error {
+	etag := `"` + Checksum(content) + `"`
+	c.Response().Header().Set("ETag", etag)
+	if generation != 0 {
+		c.Response().Header().Set("X-Ermis-Generation", strconv.Itoa(generation))
+	}
+	for _, match := range strings.Split(c.Request().Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(match) == etag {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+	return c.Blob(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+}
+
+//GetLBDConfig returns the current lbd configuration. Its generation is given if it was stored already
+func GetLBDConfig(c echo.Context) error {
+	var latest LBDSnapshot
+	content, _, err := currentLBDConfig()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := db.GetConn().Order("id desc").Limit(1).Find(&latest).Error; err != nil {
+		log.Errorf("Failed to retrieve the latest lbd configuration: %v", err)
+	}
+	generation := 0
+	if latest.Checksum == Checksum(content) {
+		generation = latest.ID
+	}
+	return serveLBDConfig(c, content, generation)
+}
+
+//GetLBDGenerations lists the stored generations of the lbd configuration, newest first
+func GetLBDGenerations(c echo.Context) error {
+	var snapshots []LBDSnapshot
+	if err := db.GetConn().Select("id, checksum, aliases, created").
+		Order("id desc").Find(&snapshots).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+	generations := []LBDGeneration{}
+	for _, s := range snapshots {
+		generations = append(generations, LBDGeneration{Generation: s.ID, Checksum: s.Checksum, Aliases: s.Aliases, Created: s.Created})
+	}
+	return c.JSON(http.StatusOK, generations)
+}
+
+//findGeneration retrieves a stored generation of the lbd configuration
+func findGeneration(param string) (LBDSnapshot, int, error) {
+	var snapshot LBDSnapshot
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return snapshot, http.StatusBadRequest, fmt.Errorf("wrong generation, received: %v", param)
+	}
+	if err = db.GetConn().Where("id = ?", id).Limit(1).Find(&snapshot).Error; err != nil {
+		return snapshot, http.StatusBadRequest, fmt.Errorf("Failed in query: %v", err)
+	}
+	if snapshot.ID == 0 {
+		return snapshot, http.StatusNotFound, fmt.Errorf("the generation %v does not exist", id)
+	}
+	return snapshot, http.StatusOK, nil
+}
+
+//GetLBDGeneration returns a stored generation of the lbd configuration
+func GetLBDGeneration(c echo.Context) error {
+	snapshot, status, err := findGeneration(c.Param("generation"))
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	return serveLBDConfig(c, snapshot.Content, snapshot.ID)
+}
+
+//DiffLBDGenerations compares two generations(from, to) of the lbd configuration. Without to, the current one is used
+func DiffLBDGenerations(c echo.Context) error {
+	from, status, err := findGeneration(c.QueryParam("from"))
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	to := LBDSnapshot{}
+	if param := c.QueryParam("to"); param != "" {
+		if to, status, err = findGeneration(param); err != nil {
+			return echo.NewHTTPError(status, err.Error())
+		}
+	} else if to.Content, _, err = currentLBDConfig(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from": from.ID,
+		"to":   to.ID,
+		"diff": DiffConfigs(from.Content, to.Content),
+	})
+}
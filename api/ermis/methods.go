@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -34,6 +35,8 @@ type (
 		User             string       `  gorm:"type:varchar(40);not null"             valid:"optional,alphanum" `
 		TTL              int          `  gorm:"type:smallint(6);default:60;not null"  valid:"optional,int"`
 		LastModification sql.NullTime `  gorm:"type:date"                             valid:"-"`
+		LegacyAuth       bool         `  gorm:"not null;default:true"                 valid:"-"`
+		StalePeriod      int          `  gorm:"type:smallint(6);not null;default:0"   valid:"optional,int"`
 		Cnames           []Cname      `  gorm:"foreignkey:CnameAliasID"               valid:"optional"`
 		Relations        []Relation   `                                               valid:"optional"`
 		Alarms           []Alarm      `  gorm:"foreignkey:AlarmAliasID"               valid:"optional" `
@@ -49,26 +52,101 @@ type (
 
 	//Relation describes the many-to-many relation between nodes/aliases
 	Relation struct {
-		ID             int          `  gorm:"type:int(11);not null;auto_increment"  valid:"optional, int" `
-		Node           *Node        `                                  valid:"required"`
-		NodeID         int          ` gorm:"type:int(11);not null"                  valid:"optional, int"`
-		Alias          *Alias       `                                  valid:"optional"`
-		AliasID        int          ` gorm:"type:int(11);not null"                  valid:"optional,int"`
-		Blacklist      bool         ` gorm:"not null"                  valid:"-"`
-		Load           int          `                                  valid:"optional, int"`
-		LastLoadUpdate sql.NullTime `gorm:"type:date"                  valid:"-"`
+		ID              int          `  gorm:"type:int(11);not null;auto_increment"  valid:"optional, int" `
+		Node            *Node        `                                  valid:"required"`
+		NodeID          int          ` gorm:"type:int(11);not null"                  valid:"optional, int"`
+		Alias           *Alias       `                                  valid:"optional"`
+		AliasID         int          ` gorm:"type:int(11);not null"                  valid:"optional,int"`
+		Blacklist       bool         ` gorm:"not null"                  valid:"-"`
+		Load            int          `                                  valid:"optional, int"`
+		LastLoadUpdate  sql.NullTime `gorm:"type:datetime"              valid:"-"`
+		Stale           bool         ` gorm:"not null;default:false"    valid:"-"` //no load reported for the stale period
+		AutoBlacklisted bool         ` gorm:"not null;default:false"    valid:"-"` //blacklisted because it became stale
 	}
 	//Alarm describes the one to many relation between an alias and its alarms
 	Alarm struct {
-		ID           int          `  gorm:"type:int(11);auto_increment;primaryKey"   valid:"optional, int"`
-		AlarmAliasID int          `  gorm:"type:int(11);not null"                    valid:"optional,int"`
-		Alias        string       `  gorm:"type:varchar(40);not null"   valid:"required, dns" `
-		Name         string       `  gorm:"type:varchar(20);not null"   valid:"required, in(minimum)"`
-		Recipient    string       `  gorm:"type:varchar(40);not null"   valid:"required, email"`
-		Parameter    int          `  gorm:"type:smallint(6);not null"   valid:"required, range(0|1000)"`
-		Active       bool         `  gorm:"not null"                    valid:"-"`
-		LastCheck    sql.NullTime `  gorm:"type:date"                   valid:"-"`
-		LastActive   sql.NullTime `  gorm:"type:date"                   valid:"-"`
+		ID               int          `  gorm:"type:int(11);auto_increment;primaryKey"   valid:"optional, int"`
+		AlarmAliasID     int          `  gorm:"type:int(11);not null"                    valid:"optional,int"`
+		Alias            string       `  gorm:"type:varchar(40);not null"   valid:"required, dns" `
+		Name             string       `  gorm:"type:varchar(20);not null"   valid:"required, alarm"`
+		Recipient        string       `  gorm:"type:varchar(255);not null"  valid:"required, recipient"`
+		Parameter        int          `  gorm:"type:smallint(6);not null"   valid:"optional"`
+		Active           bool         `  gorm:"not null"                    valid:"-"`
+		LastCheck        sql.NullTime `  gorm:"type:datetime"               valid:"-"`
+		LastActive       sql.NullTime `  gorm:"type:datetime"               valid:"-"`
+		Failures         int          `  gorm:"not null;default:0"          valid:"-"`
+		Successes        int          `  gorm:"not null;default:0"          valid:"-"`
+		LastNotification sql.NullTime `  gorm:"type:datetime"               valid:"-"`
+		State            string       `  gorm:"type:varchar(10);not null;default:''" valid:"-"`
+	}
+
+	//AlarmEvent records a state transition of an alarm, with the value observed by the check
+	AlarmEvent struct {
+		ID       int       `  gorm:"type:int(11);auto_increment;primaryKey"`
+		AlarmID  int       `  gorm:"type:int(11);not null;index"`
+		Alias    string    `  gorm:"type:varchar(40);not null;index"`
+		Name     string    `  gorm:"type:varchar(20);not null"`
+		Time     time.Time `  gorm:"type:datetime;not null"`
+		OldState string    `  gorm:"type:varchar(10);not null"`
+		NewState string    `  gorm:"type:varchar(10);not null"`
+		Value    int       `  gorm:"not null"`
+		Silenced bool      `  gorm:"not null"`
+	}
+
+	//Silence mutes the notifications of the alarms it covers between its start and end.
+	//It covers a hostgroup, optionally restricted to an alias or a single alarm
+	Silence struct {
+		ID        int       `  gorm:"type:int(11);auto_increment;primaryKey"  valid:"optional,int"`
+		Alias     string    `  gorm:"type:varchar(40);not null"   valid:"optional,dns"`
+		Hostgroup string    `  gorm:"type:longtext;not null"      valid:"required,hostgroup"`
+		AlarmID   int       `  gorm:"type:int(11);not null"       valid:"optional,int"`
+		Start     time.Time `  gorm:"type:datetime;not null"      valid:"-"`
+		End       time.Time `  gorm:"type:datetime;not null"      valid:"-"`
+		Creator   string    `  gorm:"type:varchar(40);not null"   valid:"required"`
+		Reason    string    `  gorm:"type:varchar(255);not null"  valid:"required"`
+	}
+
+	//QueuedNotification waits in the digest of its recipient until the digest window closes
+	QueuedNotification struct {
+		ID        int       `  gorm:"type:int(11);auto_increment;primaryKey"`
+		Recipient string    `  gorm:"type:varchar(255);not null;index"`
+		Alias     string    `  gorm:"type:varchar(40);not null"`
+		Alarm     string    `  gorm:"type:varchar(20);not null"`
+		Parameter int       `  gorm:"type:smallint(6);not null"`
+		Condition string    `  gorm:"type:varchar(255);not null"`
+		State     string    `  gorm:"type:varchar(10);not null"`
+		Time      time.Time `  gorm:"type:datetime;not null"`
+	}
+
+	//SecretRotation tracks the rotation of the secret of an alias. While rotating,
+	//the next secret is accepted together with the current one until it is promoted
+	SecretRotation struct {
+		ID           int          `  gorm:"type:int(11);auto_increment;primaryKey"`
+		Alias        string       `  gorm:"type:varchar(40);not null;unique"`
+		State        string       `  gorm:"type:varchar(10);not null"`
+		Started      sql.NullTime `  gorm:"type:datetime"`
+		PromoteAt    sql.NullTime `  gorm:"type:datetime"`
+		LastRotation sql.NullTime `  gorm:"type:datetime"`
+		Creator      string       `  gorm:"type:varchar(40);not null"`
+		Error        string       `  gorm:"type:varchar(255);not null"`
+	}
+	//LoadSample is a load reported by a node in an alias. The raw samples have no resolution,
+	//the downsampled ones average the period of resolution seconds that starts at their time
+	LoadSample struct {
+		ID         int       `  gorm:"type:int(11);auto_increment;primaryKey"`
+		AliasID    int       `  gorm:"type:int(11);not null;index:idx_load_sample_alias,priority:1"`
+		NodeID     int       `  gorm:"type:int(11);not null;index:idx_load_sample_alias,priority:2;index:idx_load_sample_node,priority:1"`
+		Time       time.Time `  gorm:"type:datetime;not null;index:idx_load_sample_alias,priority:3;index:idx_load_sample_node,priority:2"`
+		Load       int       `  gorm:"not null"`
+		Resolution int       `  gorm:"not null;default:0"`
+	}
+	//LBDSnapshot is a generation of the lbd configuration, stored whenever the configuration changes
+	LBDSnapshot struct {
+		ID       int       `  gorm:"type:int(11);auto_increment;primaryKey"`
+		Checksum string    `  gorm:"type:varchar(64);not null"`
+		Content  string    `  gorm:"type:longtext;not null"`
+		Aliases  int       `  gorm:"not null"`
+		Created  time.Time `  gorm:"type:datetime;not null"`
 	}
 
 	//Cname structure is a model for the cname description
@@ -119,13 +197,27 @@ func GetObjects(param string) (query []Alias, err error) {
 
 }
 
+//GetObjectsByName returns the aliases found for a list of names, using a single query
+func GetObjectsByName(names []string) (query []Alias, err error) {
+	err = db.GetConn().Preload("Relations.Node").
+		Preload("Cnames").
+		Preload("Alarms").
+		Where("alias_name IN ?", names).
+		Order("alias_name").
+		Find(&query).Error
+	if err != nil {
+		return nil, errors.New("Failed in query: " + err.Error())
+	}
+	return query, nil
+}
+
 ////////////////////////ALIAS METHODS////////////////////////////////
 
 //CreateObjectInDB creates an alias
-func (alias Alias) createObjectInDB() (err error) {
+func (alias Alias) createObjectInDB(conn *gorm.DB) (err error) {
 
 	//Create object in the DB with transactions, if smth goes wrong its rolledback
-	if err := CreateTransactions(alias); err != nil {
+	if err := CreateTransactions(conn, alias); err != nil {
 		return err
 	}
 
@@ -134,9 +226,9 @@ func (alias Alias) createObjectInDB() (err error) {
 }
 
 //deleteObject deletes an alias and its Relations
-func (alias Alias) deleteObjectInDB() (err error) {
+func (alias Alias) deleteObjectInDB(conn *gorm.DB) (err error) {
 	//Delete from DB
-	if err := deleteTransactions(alias); err != nil {
+	if err := DeleteTransactions(conn, alias); err != nil {
 		return err
 	}
 	return nil
@@ -144,8 +236,8 @@ func (alias Alias) deleteObjectInDB() (err error) {
 }
 
 //UpdateAlias modifies aliases and its associations
-func (alias Alias) updateAlias() (err error) {
-	if err := aliasUpdateTransactions(alias); err != nil {
+func (alias Alias) updateAlias(conn *gorm.DB) (err error) {
+	if err := aliasUpdateTransactions(conn, alias); err != nil {
 		return err
 	}
 
@@ -153,18 +245,18 @@ func (alias Alias) updateAlias() (err error) {
 }
 
 //updateNodes updates alias with new nodes
-func (alias Alias) updateNodes() (err error) {
+func (alias Alias) updateNodes(conn *gorm.DB) (err error) {
 	var (
 		relationsInDB []Relation
 		intf          PrivilegeIntf
 	)
 	//Let's find the registered nodes for this alias
-	db.GetConn().Preload("Node").Where("alias_id=?", alias.ID).Find(&relationsInDB)
+	conn.Preload("Node").Where("alias_id=?", alias.ID).Find(&relationsInDB)
 
 	for _, r := range relationsInDB {
 		intf = r
 		if ok, _ := Compare(intf, alias.Relations); !ok {
-			if err = deleteNodeTransactions(r); err != nil {
+			if err = deleteNodeTransactions(conn, r); err != nil {
 				return errors.New("Failed to delete existing node " +
 					r.Node.NodeName + " while updating, with error: " + err.Error())
 			}
@@ -173,13 +265,13 @@ func (alias Alias) updateNodes() (err error) {
 	for _, r := range alias.Relations {
 		intf = r
 		if ok, _ := Compare(intf, relationsInDB); !ok {
-			if err = AddNodeTransactions(r); err != nil {
+			if err = AddNodeTransactions(conn, r); err != nil {
 				return errors.New("Failed to add new node " +
 					r.Node.NodeName + " while updating, with error: " + err.Error())
 			}
 			//If relation exists we also check if user modified its privileges
 		} else if ok, privilege := Compare(intf, relationsInDB); ok && !privilege {
-			if err = updatePrivilegeTransactions(r); err != nil {
+			if err = updatePrivilegeTransactions(conn, r); err != nil {
 				return errors.New("Failed to update privilege for node " +
 					r.Node.NodeName + " while updating, with error: " + err.Error())
 			}
@@ -192,19 +284,19 @@ func (alias Alias) updateNodes() (err error) {
 
 //Update the cnames
 //updateCnames updates cnames in DB
-func (alias Alias) updateCnames() (err error) {
+func (alias Alias) updateCnames(conn *gorm.DB) (err error) {
 	var (
 		cnamesInDB []Cname
 		intf       ContainsIntf
 	)
 	//Let's see what cnames are already registered for this alias
-	db.GetConn().Model(&alias).Association("Cnames").Find(&cnamesInDB)
+	conn.Model(&alias).Association("Cnames").Find(&cnamesInDB)
 
 	if len(alias.Cnames) > 0 { //there are cnames, delete and add accordingly
 		for _, v := range cnamesInDB {
 			intf = v
 			if !Contains(intf, alias.Cnames) {
-				if err = deleteCnameTransactions(v); err != nil {
+				if err = deleteCnameTransactions(conn, v); err != nil {
 					return errors.New("Failed to delete existing cname " +
 						v.Cname + " while updating, with error: " + err.Error())
 				}
@@ -214,7 +306,7 @@ func (alias Alias) updateCnames() (err error) {
 		for _, v := range alias.Cnames {
 			intf = v
 			if !Contains(intf, cnamesInDB) {
-				if err = addCnameTransactions(v); err != nil {
+				if err = addCnameTransactions(conn, v); err != nil {
 					return errors.New("Failed to add new cname " +
 						v.Cname + " while updating, with error: " + err.Error())
 				}
@@ -224,7 +316,7 @@ func (alias Alias) updateCnames() (err error) {
 
 	} else { //user deleted everything, so do we
 		for _, v := range cnamesInDB {
-			if err = deleteCnameTransactions(v); err != nil {
+			if err = deleteCnameTransactions(conn, v); err != nil {
 				return errors.New("Failed to delete cname " +
 					v.Cname + " while purging all, with error: " + err.Error())
 			}
@@ -234,18 +326,18 @@ func (alias Alias) updateCnames() (err error) {
 }
 
 //Update the alarms
-func (alias Alias) updateAlarms() (err error) {
+func (alias Alias) updateAlarms(conn *gorm.DB) (err error) {
 	var (
 		alarmsInDB []Alarm
 		intf       ContainsIntf
 	)
 	//Let's see what alarms are already registered for this alias
-	db.GetConn().Model(&alias).Association("Alarms").Find(&alarmsInDB)
+	conn.Model(&alias).Association("Alarms").Find(&alarmsInDB)
 	if len(alias.Alarms) > 0 {
 		for _, a := range alarmsInDB {
 			intf = a
 			if !Contains(intf, alias.Alarms) {
-				if err = deleteAlarmTransactions(a); err != nil {
+				if err = deleteAlarmTransactions(conn, a); err != nil {
 					return errors.New("Failed to delete existing alarm " +
 						a.Name + " while updating, with error: " + err.Error())
 				}
@@ -255,7 +347,7 @@ func (alias Alias) updateAlarms() (err error) {
 		for _, a := range alias.Alarms {
 			intf = a
 			if !Contains(intf, alarmsInDB) {
-				if err = addAlarmTransactions(a); err != nil {
+				if err = addAlarmTransactions(conn, &a); err != nil {
 					return errors.New("Failed to add alarm " +
 						a.Name + ":" +
 						a.Recipient + ":" +
@@ -269,7 +361,7 @@ func (alias Alias) updateAlarms() (err error) {
 
 	} else {
 		for _, a := range alarmsInDB {
-			if err = deleteAlarmTransactions(a); err != nil {
+			if err = deleteAlarmTransactions(conn, a); err != nil {
 				return errors.New("Failed to delete alarm " +
 					a.Name + ":" +
 					a.Recipient + ":" +
@@ -283,9 +375,21 @@ func (alias Alias) updateAlarms() (err error) {
 }
 
 func (alias Alias) createSecret() error {
-	newsecret := generateRandomSecret()
+	newsecret, err := generateRandomSecret()
+	if err != nil {
+		return err
+	}
 	return auth.PostSecret(alias.AliasName, newsecret)
 }
 func (alias Alias) deleteSecret() error {
+	//an unfinished rotation leaves the next secret behind
+	if rotation, err := findRotation(alias.AliasName); err == nil && rotation.State == RotationRotating {
+		if err := auth.DeleteSecret(NextSecretName(alias.AliasName)); err != nil {
+			log.Errorf("failed to delete the next secret of %v: %v", alias.AliasName, err)
+		}
+	}
+	if err := db.GetConn().Where("alias = ?", alias.AliasName).Delete(&SecretRotation{}).Error; err != nil {
+		log.Errorf("failed to delete the secret rotation of %v: %v", alias.AliasName, err)
+	}
 	return auth.DeleteSecret(alias.AliasName)
 }
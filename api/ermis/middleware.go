@@ -7,8 +7,10 @@ users authorization in the hostgroups he works on*/
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -36,12 +38,23 @@ func CheckAuthorization(nextHandler echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
-func askTeigi(c echo.Context, nextHandler echo.HandlerFunc, username string) error {
-	var (
-		authInNewHg bool
-		authInOldHg bool
-	)
+//CheckIdentity only makes sure that a username is provided. It is used by the handlers
+//that act on many aliases at once, which authorize every alias separately with isAuthorized
+func CheckIdentity(nextHandler echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		username := c.Request().Header.Get("X-Forwarded-User")
+		if username != GetUsername() {
+			SetUser(username)
+		}
+		if GetUsername() != "" {
+			return nextHandler(c)
+		}
+		return MessageToUser(c, http.StatusUnauthorized,
+			"Authorization failed. No username provided", "home.html")
+	}
+}
 
+func askTeigi(c echo.Context, nextHandler echo.HandlerFunc, username string) error {
 	//We extract the hostgroup values from the Req Body and the one in DB, for the same alias.
 	newHg, oldHg, err := findHostgroup(c)
 	if err != nil {
@@ -50,8 +63,32 @@ func askTeigi(c echo.Context, nextHandler echo.HandlerFunc, username string) err
 
 	}
 
-	//In this step we check username , against both hostgroups.
-	//We need this step to prevent unauthorized alias movements.
+	switch c.Request().Method {
+	case "PATCH", "POST", "DELETE":
+		if isAuthorized(c.Request().Method, newHg, oldHg) {
+			log.Infof("[%v] authorized by teigi for %v", GetUsername(), c.Request().Method)
+			return nextHandler(c)
+		}
+		return MessageToUser(c, http.StatusUnauthorized,
+			GetUsername()+" is unauthorized to "+c.Request().Method+" in hostgroup "+oldHg, "home.html")
+	default:
+		return MessageToUser(c, http.StatusMethodNotAllowed,
+			"Method "+c.Request().Method, "home.html")
+
+	}
+}
+
+/*isAuthorized checks the current user against the hostgroup in the request(newHg)
+and the one registered in the DB(oldHg). Both are checked to prevent unauthorized alias movements*/
+func isAuthorized(method, newHg, oldHg string) bool {
+	var (
+		authInNewHg bool
+		authInOldHg bool
+	)
+	//Ermis-lbaas-admins are superusers
+	if IsSuperuser() {
+		return true
+	}
 	if newHg != "" {
 		authInNewHg = StringInSlice(newHg, GetUsersHostgroups())
 	}
@@ -59,50 +96,24 @@ func askTeigi(c echo.Context, nextHandler echo.HandlerFunc, username string) err
 		authInOldHg = StringInSlice(oldHg, GetUsersHostgroups())
 	}
 
-	switch c.Request().Method {
+	switch method {
 	//1.In case method is PATCH...
 	case "PATCH":
 		//...and there is no hostgroup field in the Request,allow to PATCH other fields
-		//if the user is authorized in the old hostgroup
-		if newHg == "" && authInOldHg {
-			log.Infof("[%v] authorized by teigi for PATCH, using existing hostgroup", GetUsername())
-			return nextHandler(c)
-			//When PATCH-ing hostgroup value itself, verify user in both hostgroups
-		} else if authInNewHg && authInOldHg {
-			log.Infof("[%v] authorized by teigi for PATCH, using both hg", GetUsername())
-			return nextHandler(c)
-		}
-		return MessageToUser(c, http.StatusUnauthorized,
-			GetUsername()+" is unauthorized to PATCH in hostgroup "+oldHg, "home.html")
-		//2.In case method is POST...
+		//if the user is authorized in the old hostgroup.
+		//When PATCH-ing hostgroup value itself, verify user in both hostgroups
+		return (newHg == "" && authInOldHg) || (authInNewHg && authInOldHg)
+	//2.In case method is POST...
 	case "POST":
 		//Here we authorize the creation of new aliases(no hostgroup value in DB),
-		// if teigi gives the OK for the new hostgroup value.
-		if authInNewHg && oldHg == "" {
-			log.Infof("[%v] authorized by teigi to POST new alias", GetUsername())
-			return nextHandler(c)
-
-			//When modifying , check both hostgroups
-		} else if authInNewHg && authInOldHg {
-			log.Info("[" + GetUsername() + "] Authorized by teigi for POST")
-			return nextHandler(c)
-		}
-		return MessageToUser(c, http.StatusUnauthorized,
-			GetUsername()+" is unauthorized to POST in hostgroup "+oldHg, "home.html")
-		// 3.In case method is DELETE...
+		//if teigi gives the OK for the new hostgroup value. When modifying, check both hostgroups.
+		//Adding a sub-resource(cname, alarm) to an alias only requires the existing hostgroup
+		return (authInNewHg && oldHg == "") || (authInNewHg && authInOldHg) || (newHg == "" && authInOldHg)
+	// 3.In case method is DELETE, we make sure user is auth in the existing hg
 	case "DELETE":
-		//We make sure user is auth in the existing hg
-		if authInOldHg {
-			log.Infof("[%v] authorized by teigi for DELETE", GetUsername())
-			return nextHandler(c)
-		}
-		return MessageToUser(c, http.StatusUnauthorized,
-			GetUsername()+" is unauthorized to DELETE from hostgroup "+oldHg, "home.html")
-	default:
-		return MessageToUser(c, http.StatusMethodNotAllowed,
-			"Method "+c.Request().Method, "home.html")
-
+		return authInOldHg
 	}
+	return false
 }
 
 func findHostgroup(c echo.Context) (newHg string, oldHg string, err error) {
@@ -127,15 +138,17 @@ func findHostgroup(c echo.Context) (newHg string, oldHg string, err error) {
 			//Restore body, so we can bind again in the handlers
 			c.Request().Body = ioutil.NopCloser(bytes.NewBuffer(raw))
 
-			// Unmarshal body of request
-			var b body
-			err = json.Unmarshal(raw, &b)
-			if err != nil {
-				return "", "", err
+			// Unmarshal body of request, sub-resource requests may have no body
+			if len(raw) != 0 {
+				var b body
+				err = json.Unmarshal(raw, &b)
+				if err != nil {
+					return "", "", err
+				}
+				//Set values we need
+				aliasToquery = b.Alias
+				newHg = b.Hostgroup
 			}
-			//Set values we need
-			aliasToquery = b.Alias
-			newHg = b.Hostgroup
 		}
 		//UI sends Content-Type x-www-form-urlencoded
 	} else if c.Request().Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
@@ -143,10 +156,12 @@ func findHostgroup(c echo.Context) (newHg string, oldHg string, err error) {
 		aliasToquery = c.FormValue("alias_name")
 	}
 
-	//Get the hostgroup that is registered for the same alias.
-	alias, _ := GetObjects(aliasToquery)
-	if len(alias) != 0 {
-		oldHg = alias[0].Hostgroup
+	newHg, oldHg, err = ResolveHostgroups(c.Param("id"), aliasToquery, newHg, func(param string) []Alias {
+		alias, _ := GetObjects(param)
+		return alias
+	})
+	if err != nil {
+		return "", "", err
 	}
 
 	//In case the hostgroup fields are empty in the request and the DB
@@ -159,3 +174,40 @@ func findHostgroup(c echo.Context) (newHg string, oldHg string, err error) {
 
 	return newHg, oldHg, nil
 }
+
+/*ResolveHostgroups returns the hostgroup of the request(newHg) and the one registered
+for the alias(oldHg), retrieved with lookup. The routes that address an alias in the
+path(pathID) authorize that alias only, because it is the one their handlers act on.
+A different alias in the body or query is refused, otherwise its hostgroup would be
+authorized instead of the one of the alias modified*/
+func ResolveHostgroups(pathID, requested, newHg string, lookup func(string) []Alias) (string, string, error) {
+	var oldHg string
+	aliasToquery := requested
+	if pathID != "" {
+		param := pathID
+		if _, err := strconv.Atoi(pathID); err != nil {
+			param = FullAliasName(pathID)
+		}
+		aliasToquery = param
+		inPath := lookup(param)
+		if len(inPath) != 0 {
+			oldHg = inPath[0].Hostgroup
+			if requested != "" && FullAliasName(requested) != inPath[0].AliasName {
+				return "", "", fmt.Errorf("the alias %v of the request is not the alias %v of the path",
+					requested, inPath[0].AliasName)
+			}
+		} else if requested != "" && FullAliasName(requested) != param {
+			return "", "", fmt.Errorf("the alias %v of the request is not the alias %v of the path",
+				requested, pathID)
+		}
+		return newHg, oldHg, nil
+	}
+
+	//Get the hostgroup that is registered for the same alias.
+	if aliasToquery != "" {
+		if alias := lookup(aliasToquery); len(alias) != 0 {
+			oldHg = alias[0].Hostgroup
+		}
+	}
+	return newHg, oldHg, nil
+}
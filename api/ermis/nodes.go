@@ -0,0 +1,249 @@
+package ermis
+
+/*This file contains the node-centric handlers. They answer in which aliases
+a node is registered and allow acting on a node in every alias of a hostgroup*/
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+type (
+	//NodeResource describes a node and its membership in every alias
+	NodeResource struct {
+		NodeName string           `json:"node_name"`
+		Aliases  []NodeMembership `json:"aliases"`
+	}
+	//NodeMembership describes the state of a node in a single alias
+	NodeMembership struct {
+		AliasName      string     `json:"alias_name"`
+		Hostgroup      string     `json:"hostgroup"`
+		Blacklisted    bool       `json:"blacklisted"`
+		Load           int        `json:"load"`
+		LastLoadUpdate *time.Time `json:"last_load_update"`
+		//Stale nodes stopped reporting their load, they may have been blacklisted automatically
+		Stale           bool `json:"stale"`
+		AutoBlacklisted bool `json:"auto_blacklisted"`
+	}
+	//NodeAction describes the change of a node in all the aliases of a hostgroup
+	NodeAction struct {
+		Hostgroup string `json:"hostgroup"`
+		Blacklist *bool  `json:"blacklist"`
+	}
+)
+
+//getNodes retrieves the nodes with their relations and aliases. An empty name returns every node
+func getNodes(name string) (nodes []Node, err error) {
+	query := db.GetConn().Preload("Aliases.Alias").Order("node_name")
+	if name != "" {
+		query = query.Where("node_name=?", name)
+	}
+	if err = query.Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("Failed in query: %v", err)
+	}
+	return nodes, nil
+}
+
+//describeNode packages a node with its memberships, keeping only the ones of hostgroup if given.
+//With onlyStale, only the memberships where the node is stale are kept
+func describeNode(node Node, hostgroup string, onlyStale bool) NodeResource {
+	resource := NodeResource{NodeName: node.NodeName, Aliases: []NodeMembership{}}
+	for _, r := range node.Aliases {
+		if r.Alias == nil || (hostgroup != "" && r.Alias.Hostgroup != hostgroup) || (onlyStale && !r.Stale) {
+			continue
+		}
+		membership := NodeMembership{
+			AliasName:       r.Alias.AliasName,
+			Hostgroup:       r.Alias.Hostgroup,
+			Blacklisted:     r.Blacklist,
+			Load:            r.Load,
+			Stale:           r.Stale,
+			AutoBlacklisted: r.AutoBlacklisted,
+		}
+		if r.LastLoadUpdate.Valid {
+			lastUpdate := r.LastLoadUpdate.Time
+			membership.LastLoadUpdate = &lastUpdate
+		}
+		resource.Aliases = append(resource.Aliases, membership)
+	}
+	return resource
+}
+
+//validNodeName returns the node name of the request, if it is valid
+func validNodeName(c echo.Context) (string, error) {
+	name := c.Param("name")
+	if name == "" || !govalidator.TagMap["nodes"](name) {
+		return "", fmt.Errorf("wrong node name, received: %v", name)
+	}
+	return name, nil
+}
+
+//GetNodes returns every node with its aliases. Hostgroup restricts the aliases shown,
+//stale=true returns only the nodes that stopped reporting, in the aliases where they did
+func GetNodes(c echo.Context) error {
+	hostgroup := c.QueryParam("hostgroup")
+	onlyStale := c.QueryParam("stale") == "true"
+	log.Infof("[%v] is querying for all nodes", GetUsername())
+	nodes, err := getNodes("")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	resources := []NodeResource{}
+	for _, node := range nodes {
+		resource := describeNode(node, hostgroup, onlyStale)
+		if (hostgroup != "" || onlyStale) && len(resource.Aliases) == 0 {
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	return c.JSON(http.StatusOK, resources)
+}
+
+//GetNode returns the aliases of a node, with its blacklist state and last reported load in each
+func GetNode(c echo.Context) error {
+	name, err := validNodeName(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	log.Infof("[%v] is querying for node %v", GetUsername(), name)
+	nodes, err := getNodes(name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(nodes) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "node not found")
+	}
+	return c.JSON(http.StatusOK, describeNode(nodes[0], c.QueryParam("hostgroup"), false))
+}
+
+//ModifyNode blacklists or whitelists a node in all the aliases of a hostgroup
+func ModifyNode(c echo.Context) error {
+	var action NodeAction
+	username := GetUsername()
+
+	name, err := validNodeName(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Bind(&action); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to bind parameters: %v", err))
+	}
+	defer c.Request().Body.Close()
+	if action.Blacklist == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "blacklist value is missing")
+	}
+
+	relations, status, err := nodeRelationsInHostgroup(name, action.Hostgroup, "PATCH")
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	log.Infof("[%v] setting blacklist=%v for node %v in %v aliases of hostgroup %v",
+		username, *action.Blacklist, name, len(relations), action.Hostgroup)
+
+	//The node is updated in all the aliases, or in none of them
+	if err := db.GetConn().Transaction(func(tx *gorm.DB) error {
+		for i, r := range relations {
+			if r.Blacklist != *action.Blacklist {
+				r.Blacklist = *action.Blacklist
+				if err := updatePrivilegeTransactions(tx, r); err != nil {
+					return fmt.Errorf("failed to update node %v in alias %v: %v", name, r.Alias.AliasName, err)
+				}
+				relations[i].Blacklist, relations[i].AutoBlacklisted = r.Blacklist, false
+			}
+		}
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	//The reply has the shape of the GET of the node
+	return c.JSON(http.StatusAccepted, describeNode(Node{NodeName: name, Aliases: relations}, "", false))
+}
+
+//RemoveNode removes a node from all the aliases of a hostgroup
+func RemoveNode(c echo.Context) error {
+	username := GetUsername()
+	name, err := validNodeName(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	hostgroup := c.QueryParam("hostgroup")
+
+	relations, status, err := nodeRelationsInHostgroup(name, hostgroup, "DELETE")
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	log.Infof("[%v] removing node %v from %v aliases of hostgroup %v",
+		username, name, len(relations), hostgroup)
+
+	removed := []string{}
+	//The node is removed from all the aliases, or from none of them
+	if err := db.GetConn().Transaction(func(tx *gorm.DB) error {
+		for _, r := range relations {
+			if err := deleteNodeTransactions(tx, r); err != nil {
+				return fmt.Errorf("failed to remove node %v from alias %v: %v", name, r.Alias.AliasName, err)
+			}
+			removed = append(removed, r.Alias.AliasName)
+		}
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"node_name": name,
+		"removed":   removed,
+	})
+}
+
+//nodeRelationsInHostgroup authorizes the user in the hostgroup and returns the relations of the node in it
+func nodeRelationsInHostgroup(name, hostgroup, method string) ([]Relation, int, error) {
+	var relations []Relation
+	if hostgroup == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("hostgroup is missing")
+	}
+	if !isAuthorized(method, "", hostgroup) {
+		return nil, http.StatusUnauthorized,
+			fmt.Errorf("%v is unauthorized to %v in hostgroup %v", GetUsername(), method, hostgroup)
+	}
+	nodes, err := getNodes(name)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(nodes) == 0 {
+		return nil, http.StatusNotFound, fmt.Errorf("node not found")
+	}
+	node := nodes[0]
+	for _, r := range node.Aliases {
+		if r.Alias != nil && r.Alias.Hostgroup == hostgroup {
+			r.Node = &Node{ID: node.ID, NodeName: node.NodeName}
+			relations = append(relations, r)
+		}
+	}
+	if len(relations) == 0 {
+		return nil, http.StatusNotFound,
+			fmt.Errorf("node %v is not part of any alias of hostgroup %v", name, hostgroup)
+	}
+	return relations, http.StatusOK, nil
+}
+
+//IsStale returns true if the node has not reported its load for longer than period.
+//The nodes that never reported, e.g. added by hand, are not considered stale
+func (r Relation) IsStale(period time.Duration, now time.Time) bool {
+	return r.LastLoadUpdate.Valid && now.Sub(r.LastLoadUpdate.Time) > period
+}
+
+//StalePeriod returns the time without reports after which the nodes of the alias are stale
+func StalePeriod(alias Alias) time.Duration {
+	if alias.StalePeriod > 0 {
+		return time.Duration(alias.StalePeriod) * time.Minute
+	}
+	if cfg.StaleNodes.Period > 0 {
+		return time.Duration(cfg.StaleNodes.Period) * time.Minute
+	}
+	return 30 * time.Minute
+}
@@ -0,0 +1,198 @@
+package ermis
+
+/*This file contains the procedures that create, modify and delete
+an alias in all the distributed systems(DB, DNS, tbag). They are shared
+by the single-alias handlers and the handlers that act on many aliases*/
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/asaskevich/govalidator"
+	"gitlab.cern.ch/lb-experts/goermis/auth"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+//prepareCreation sanitizes the binded data of a new alias and validates the result
+func prepareCreation(contentType string, temp Resource) (Alias, error) {
+	alias := sanitazeInCreation(contentType, temp)
+	log.Infof("[%v] sanitazed succesfully %v", GetUsername(), temp.AliasName)
+
+	if ok, err := govalidator.ValidateStruct(alias); err != nil || !ok {
+		return Alias{}, fmt.Errorf("validation error for %v: %v", temp.AliasName, err)
+	}
+	log.Infof("[%v] validation passed for alias %v", GetUsername(), temp.AliasName)
+	return alias, nil
+}
+
+//prepareModification merges the binded data with the existing alias and validates the result
+func prepareModification(contentType string, retrieved Alias, temp Resource) (Alias, error) {
+	alias, err := sanitazeInUpdate(contentType, retrieved, temp)
+	if err != nil {
+		return Alias{}, fmt.Errorf("failed to sanitize %v: %v ", temp.AliasName, err)
+	}
+	log.Infof("[%v] sanitized successfully %v", GetUsername(), temp.AliasName)
+
+	if ok, err := govalidator.ValidateStruct(alias); err != nil || !ok {
+		return Alias{}, fmt.Errorf("validation error for alias %v: %v", temp.AliasName, err)
+	}
+	log.Infof("[%v] validation check passed for %v", GetUsername(), temp.AliasName)
+	return alias, nil
+}
+
+//applyCreation creates a validated alias in DB, DNS and tbag, rolling back on failures
+func (alias Alias) applyCreation() (int, error) {
+	/******Create object in DB******/
+	if err := alias.createObjectInDB(db.GetConn()); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("creation error for %v: %v", alias.AliasName, err)
+	}
+	log.Infof("[%v] created %v in database, now creating in DNS  ",
+		alias.User, alias.AliasName)
+	return alias.completeCreation()
+}
+
+//completeCreation creates an alias already stored in DB in DNS and tbag. On failures the DB is rolled back too
+func (alias Alias) completeCreation() (int, error) {
+	/******Create in DNS******/
+	if err := alias.createInDNS(); err != nil {
+
+		log.Errorf("[%v] failed to create entry in DNS, initiating rollback for alias %v\nError:%v",
+			alias.User, alias.AliasName, err)
+
+		//rollback only DB , after failed DNS creation
+		if err := alias.RollbackInCreate(true, false); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		//on successful rollback
+		return http.StatusBadRequest,
+			fmt.Errorf("failed to create alias %v in DNS, database rolled back", alias.AliasName)
+
+	}
+
+	/******Create secret in tbag******/
+	if err := alias.createSecret(); err != nil {
+		log.Errorf("[%v] failed to create secret in tbag for alias %v, initiating rollback\nerror:%v",
+			alias.User, alias.AliasName, err)
+
+		//rollback db and dns after failed secret creation
+		if err := alias.RollbackInCreate(true, true); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		//on successful rollback
+		return http.StatusBadRequest,
+			fmt.Errorf("failed to create the secret of alias %v in tbag, database and DNS rolled back", alias.AliasName)
+	}
+	return http.StatusCreated, nil
+}
+
+//applyModification updates an existing alias and its associations in DB and DNS.
+//On DNS failures the DB is rolled back to the retrieved state
+func (alias Alias) applyModification(retrieved Alias) (int, error) {
+	//The fields and the associations are updated together, or not at all
+	if err := WithinTransaction(alias.updateInDB); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return alias.completeModification(retrieved)
+}
+
+//updateInDB updates the fields of an alias and its associations with conn
+func (alias Alias) updateInDB(conn *gorm.DB) error {
+	/****** Update alias fields(hg, external, best hosts etc.) ******/
+	if err := alias.updateAlias(conn); err != nil {
+		return fmt.Errorf("update error for alias %v: %v ", alias.AliasName, err)
+	}
+	log.Infof("[%v] updated alias %v, now will check his associations", alias.User, alias.AliasName)
+
+	/****** Update the cnames ******/
+	if err := alias.updateCnames(conn); err != nil {
+		return fmt.Errorf("update error for alias %v: %v ", alias.AliasName, err)
+	}
+	log.Infof("[%v] finished the cnames update for %v", alias.User, alias.AliasName)
+
+	/****** Update the nodes ******/
+	if err := alias.updateNodes(conn); err != nil {
+		return fmt.Errorf("update error for alias %v: %v ", alias.AliasName, err)
+	}
+	log.Infof("[%v] finished the nodes update for %v ", alias.User, alias.AliasName)
+
+	/****** Update the alarms ******/
+	if err := alias.updateAlarms(conn); err != nil {
+		return fmt.Errorf("update error for alias %v: %v ", alias.AliasName, err)
+	}
+	log.Infof("[%v] the database was updated successfully, now we can update the DNS", alias.User)
+	return nil
+}
+
+//completeModification updates in DNS an alias already updated in DB. On failures the DB is rolled back too
+func (alias Alias) completeModification(retrieved Alias) (int, error) {
+	/****** Update in DNS ******/
+	if err := alias.updateDNS(retrieved); err != nil {
+		//If something goes wrong while updating, then we use the object
+		//we had in DB before the update to restore that state, before the error
+
+		log.Errorf("[%v] could not update %v  in DNS, starting the rollback procedure",
+			alias.User, alias.AliasName)
+
+		/******Rollback******/
+		if err := alias.RollbackInModify(retrieved); err != nil {
+			return http.StatusAccepted, err
+		}
+		/******Successful rollback message******/
+		return http.StatusAccepted,
+			fmt.Errorf("rolled back to previous state completed for alias %v	, please try again later or contact admin", alias.AliasName)
+	}
+	return http.StatusAccepted, nil
+}
+
+//applyDeletion deletes an existing alias from DB, DNS and tbag, rolling back on failures
+func (alias Alias) applyDeletion() (int, error) {
+	/******delete from db******/
+	if err := alias.deleteObjectInDB(db.GetConn()); err != nil {
+		return http.StatusBadRequest, err
+
+	}
+	log.Infof("[%v] deleted from the database, now deleting from the DNS %v",
+		GetUsername(), alias.AliasName)
+	return alias.completeDeletion()
+}
+
+//completeDeletion deletes from DNS and tbag an alias already deleted from DB. On failures the DB is rolled back too
+func (alias Alias) completeDeletion() (int, error) {
+	/******Now delete from DNS******/
+	if err := alias.deleteFromDNS(); err != nil {
+		log.Errorf("[%v] something went wrong while deleting %v from DNS, initiating the rollback",
+			GetUsername(), alias.AliasName)
+
+		//rollback db deletion
+		if err := alias.RollbackInDelete(true, false); err != nil {
+			return http.StatusBadRequest, err
+
+		}
+
+		//on successful rollback
+		return http.StatusBadRequest,
+			fmt.Errorf("failed to delete alias %v from DNS, database rolled back", alias.AliasName)
+	}
+
+	/******Delete secret from tbag******/
+	if len(auth.GetSecret(alias.AliasName)) != 0 {
+
+		if err := alias.deleteSecret(); err != nil {
+			log.Errorf("[%v] failed to delete the secret from tbag for alias %v, initiating the rollback",
+				GetUsername(), alias.AliasName)
+
+			//rollback db and dns deletions
+			if err := alias.RollbackInDelete(true, true); err != nil {
+				return http.StatusBadRequest, err
+
+			}
+
+			//on successful rollback
+			return http.StatusBadRequest,
+				fmt.Errorf("failed to delete the secret of alias %v from tbag, database and DNS rolled back", alias.AliasName)
+		}
+	}
+	return http.StatusOK, nil
+}
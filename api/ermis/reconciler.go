@@ -0,0 +1,240 @@
+package ermis
+
+/*This file contains the reconciler, which converges the aliases to a
+directory of spec files(populated by an external git sync). Every file
+is owned by a hostgroup and can only manage the aliases of that hostgroup.
+The result of the last synchronization of every file is kept in memory
+and exposed through the API*/
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+//reconcilerUser is recorded as the user of the aliases modified by the reconciler
+const reconcilerUser = "reconciler"
+
+type (
+	//FileStatus describes the last synchronization of a spec file
+	FileStatus struct {
+		File      string          `json:"file"`
+		Hostgroup string          `json:"hostgroup"`
+		LastSync  time.Time       `json:"last_sync"`
+		State     string          `json:"state"`
+		Message   string          `json:"message,omitempty"`
+		Changes   []PlannedChange `json:"changes"`
+	}
+	//SpecFile is a spec file waiting to be reconciled, with the error that prevented its parsing if any
+	SpecFile struct {
+		Name string
+		Doc  SpecDocument
+		Err  error
+	}
+)
+
+var (
+	syncStatus   = make(map[string]FileStatus)
+	syncStatusMu sync.RWMutex
+)
+
+//Reconcile converges the DB and DNS to the spec files of the configured directory
+func Reconcile() {
+	files, err := filepath.Glob(filepath.Join(cfg.Reconciler.Directory, "*.y*ml"))
+	if err != nil {
+		log.Errorf("[%v] failed to list the spec files in %v: %v", reconcilerUser, cfg.Reconciler.Directory, err)
+		return
+	}
+	sort.Strings(files)
+
+	existing, err := GetObjects("all")
+	if err != nil {
+		log.Errorf("[%v] failed to retrieve the aliases: %v", reconcilerUser, err)
+		return
+	}
+
+	var specFiles []SpecFile
+	for _, file := range files {
+		doc, err := readSpecFile(file)
+		if err != nil {
+			log.Errorf("[%v] skipping spec file %v: %v", reconcilerUser, filepath.Base(file), err)
+		}
+		specFiles = append(specFiles, SpecFile{Name: filepath.Base(file), Doc: doc, Err: err})
+	}
+
+	statuses := PlanReconciliation(specFiles, existing, cfg.Reconciler.Prune)
+	for _, f := range specFiles {
+		status := statuses[f.Name]
+		for i := range status.Changes {
+			//the refused changes already carry their status
+			if status.Changes[i].Status == 0 {
+				status.Changes[i].apply(reconcilerUser)
+			}
+		}
+		statuses[f.Name] = status
+	}
+
+	for name, status := range statuses {
+		if status.State == "" {
+			status.State = "synced"
+			for _, change := range status.Changes {
+				if change.Status == http.StatusForbidden || change.Status == http.StatusConflict {
+					status.State = "refused"
+				} else if change.Status >= 300 {
+					status.State = "error"
+					break
+				}
+			}
+			statuses[name] = status
+		}
+		log.Infof("[%v] spec file %v is %v", reconcilerUser, name, status.State)
+	}
+
+	syncStatusMu.Lock()
+	syncStatus = statuses
+	syncStatusMu.Unlock()
+}
+
+/*PlanReconciliation decides the changes of every spec file, without applying them.
+A change is refused if its alias is already described by a previous file or does not
+belong to the owner of the file. With prune, the aliases of a hostgroup missing from all
+the files of that hostgroup are deleted, reported under the first file of the hostgroup.
+The hostgroups with a file in error are not pruned, the aliases of that file would be lost.
+If a file cannot be parsed its owner is unknown, so nothing is pruned at all*/
+func PlanReconciliation(files []SpecFile, existing []Alias, prune bool) map[string]FileStatus {
+	statuses := make(map[string]FileStatus)
+	owners := make(map[string]string) //alias name --> file describing it
+	described := make(map[string][]string)
+	failed := make(map[string]bool) //hostgroups with a file in error
+	var parsed []SpecFile
+	for _, f := range files {
+		status := FileStatus{File: f.Name, Hostgroup: f.Doc.Hostgroup, LastSync: time.Now(), Changes: []PlannedChange{}}
+		if f.Err != nil {
+			status.State = "error"
+			status.Message = f.Err.Error()
+			statuses[f.Name] = status
+			if f.Doc.Hostgroup == "" {
+				prune = false
+			}
+			failed[f.Doc.Hostgroup] = true
+			continue
+		}
+		statuses[f.Name] = status
+		parsed = append(parsed, f)
+	}
+
+	for _, f := range parsed {
+		status := statuses[f.Name]
+		plan, err := PlanSpecs(f.Doc, existing, false)
+		if err != nil {
+			status.State = "error"
+			status.Message = err.Error()
+			statuses[f.Name] = status
+			failed[f.Doc.Hostgroup] = true
+			continue
+		}
+		for _, change := range plan.Changes {
+			if owner, found := owners[change.AliasName]; found {
+				change.Status = http.StatusConflict
+				change.Message = fmt.Sprintf("alias is already described by %v", owner)
+			} else if code, err := f.Doc.owns(change); err != nil {
+				change.Status = code
+				change.Message = err.Error()
+			} else {
+				owners[change.AliasName] = f.Name
+			}
+			described[f.Doc.Hostgroup] = append(described[f.Doc.Hostgroup], change.AliasName)
+			status.Changes = append(status.Changes, change)
+		}
+		statuses[f.Name] = status
+	}
+
+	if !prune {
+		return statuses
+	}
+	for _, f := range parsed {
+		names, found := described[f.Doc.Hostgroup]
+		if !found {
+			continue
+		}
+		delete(described, f.Doc.Hostgroup)
+		if failed[f.Doc.Hostgroup] {
+			log.Warnf("[%v] not pruning the hostgroup %v, one of its spec files is in error", reconcilerUser, f.Doc.Hostgroup)
+			continue
+		}
+		status := statuses[f.Name]
+		for _, alias := range existing {
+			if alias.Hostgroup != f.Doc.Hostgroup || StringInSlice(alias.AliasName, names) {
+				continue
+			}
+			status.Changes = append(status.Changes, PlannedChange{AliasName: alias.AliasName, Action: "delete", current: alias})
+		}
+		statuses[f.Name] = status
+	}
+	return statuses
+}
+
+//readSpecFile parses a spec file and makes sure it declares its owner
+func readSpecFile(file string) (doc SpecDocument, err error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return doc, err
+	}
+	if err = yaml.Unmarshal(raw, &doc); err != nil {
+		//a partial decode does not tell the owner
+		return SpecDocument{}, fmt.Errorf("failed to decode the spec document: %v", err)
+	}
+	if doc.Version != SpecVersion {
+		return doc, fmt.Errorf("unsupported spec version %v, expected %v", doc.Version, SpecVersion)
+	}
+	if doc.Hostgroup == "" {
+		return doc, fmt.Errorf("the spec file does not declare its owner hostgroup")
+	}
+	//aliases inherit the hostgroup of the file
+	for i := range doc.Aliases {
+		if doc.Aliases[i].Hostgroup == "" {
+			doc.Aliases[i].Hostgroup = doc.Hostgroup
+		}
+	}
+	return doc, nil
+}
+
+//owns refuses the changes on aliases that do not belong to the owner of the file
+func (doc SpecDocument) owns(change PlannedChange) (int, error) {
+	if change.Action != "delete" && change.spec.Hostgroup != doc.Hostgroup {
+		return http.StatusForbidden,
+			fmt.Errorf("alias declares hostgroup %v, but the file is owned by %v", change.spec.Hostgroup, doc.Hostgroup)
+	}
+	if change.Action != "create" && change.current.Hostgroup != doc.Hostgroup {
+		return http.StatusForbidden,
+			fmt.Errorf("alias belongs to hostgroup %v, but the file is owned by %v", change.current.Hostgroup, doc.Hostgroup)
+	}
+	return http.StatusOK, nil
+}
+
+//GetSyncStatus returns the result of the last synchronization of every spec file
+func GetSyncStatus(c echo.Context) error {
+	var statuses []FileStatus
+	hostgroup := c.QueryParam("hostgroup")
+
+	syncStatusMu.RLock()
+	for _, status := range syncStatus {
+		if hostgroup == "" || strings.EqualFold(status.Hostgroup, hostgroup) {
+			statuses = append(statuses, status)
+		}
+	}
+	syncStatusMu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].File < statuses[j].File })
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enabled": cfg.Reconciler.Enabled,
+		"files":   statuses,
+	})
+}
@@ -0,0 +1,209 @@
+package ermis
+
+/*This file contains the rotation of the alias secrets. A rotation stores a
+new random secret in tbag as the next secret of the alias. During the grace
+period the lbclients may authenticate with either the current or the next
+secret, so the nodes can pick up the new one. Then the rotation job promotes
+the next secret to current*/
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/auth"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+//The states of a secret rotation
+const (
+	RotationIdle     = "idle"
+	RotationRotating = "rotating"
+	//RotationPromoted is not stored, it marks the idle rotations promoted less than a cache TTL ago
+	RotationPromoted = "promoted"
+)
+
+//RotationResource presents the rotation of the secret of an alias. It never contains the secrets
+type RotationResource struct {
+	AliasName    string     `json:"alias_name"`
+	State        string     `json:"state"`
+	Started      *time.Time `json:"started,omitempty"`
+	PromoteAt    *time.Time `json:"promote_at,omitempty"`
+	LastRotation *time.Time `json:"last_rotation,omitempty"`
+	Creator      string     `json:"creator,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+//NextSecretName is the name under which the next secret of an alias is stored
+func NextSecretName(aliasname string) string {
+	return aliasname + "_next"
+}
+
+//rotationGrace returns how long both secrets are accepted, 60 minutes by default
+func rotationGrace() time.Duration {
+	if cfg.Secrets.RotationGrace <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(cfg.Secrets.RotationGrace) * time.Minute
+}
+
+/*RotatingAliases returns which of the aliases are in the grace period of a rotation,
+or were promoted less than a cache TTL ago. The promotion only invalidates the cache
+of the replica that ran it, so the others may still have the previous secret cached*/
+func RotatingAliases(aliasnames []string) (map[string]string, error) {
+	var rotations []SecretRotation
+	rotating := make(map[string]string)
+	if err := db.GetConn().Where("alias IN ? AND (state = ? OR last_rotation >= ?)",
+		aliasnames, RotationRotating, time.Now().Add(-auth.CacheTTL())).
+		Find(&rotations).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rotations {
+		if r.State == RotationRotating {
+			rotating[r.Alias] = RotationRotating
+		} else {
+			rotating[r.Alias] = RotationPromoted
+		}
+	}
+	return rotating, nil
+}
+
+//findRotation returns the rotation of an alias, idle if it was never rotated
+func findRotation(aliasname string) (rotation SecretRotation, err error) {
+	err = db.GetConn().Where("alias = ?", aliasname).Limit(1).Find(&rotation).Error
+	if rotation.ID == 0 {
+		rotation = SecretRotation{Alias: aliasname, State: RotationIdle}
+	}
+	return rotation, err
+}
+
+//toRotationResource packages a rotation for the reply
+func toRotationResource(r SecretRotation) RotationResource {
+	resource := RotationResource{AliasName: r.Alias, State: r.State, Creator: r.Creator, Error: r.Error}
+	if r.Started.Valid {
+		resource.Started = &r.Started.Time
+	}
+	if r.PromoteAt.Valid {
+		resource.PromoteAt = &r.PromoteAt.Time
+	}
+	if r.LastRotation.Valid {
+		resource.LastRotation = &r.LastRotation.Time
+	}
+	return resource
+}
+
+//GetSecretRotation returns the rotation status of the secret of an alias to its owners
+func GetSecretRotation(c echo.Context) error {
+	alias, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	if !isAuthorized("PATCH", "", alias.Hostgroup) {
+		return echo.NewHTTPError(http.StatusUnauthorized,
+			GetUsername()+" is unauthorized in hostgroup "+alias.Hostgroup)
+	}
+	rotation, err := findRotation(alias.AliasName)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+	return c.JSON(http.StatusOK, toRotationResource(rotation))
+}
+
+//RotateSecret starts the rotation of the secret of an alias
+func RotateSecret(c echo.Context) error {
+	username := GetUsername()
+	alias, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	rotation, err := findRotation(alias.AliasName)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+	if rotation.State == RotationRotating {
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("the secret of %v is already rotating until %v", alias.AliasName, rotation.PromoteAt.Time))
+	}
+	//The replicas may still cache the next secret of the previous rotation
+	if rotation.LastRotation.Valid && time.Since(rotation.LastRotation.Time) < auth.CacheTTL() {
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("the secret of %v was rotated at %v, please retry after %v",
+				alias.AliasName, rotation.LastRotation.Time, rotation.LastRotation.Time.Add(auth.CacheTTL())))
+	}
+
+	next, err := generateRandomSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := auth.PostSecret(NextSecretName(alias.AliasName), next); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to store the next secret of %v in tbag: %v", alias.AliasName, err))
+	}
+	now := time.Now()
+	rotation.State = RotationRotating
+	rotation.Started = sql.NullTime{Time: now, Valid: true}
+	rotation.PromoteAt = sql.NullTime{Time: now.Add(rotationGrace()), Valid: true}
+	rotation.Creator = username
+	rotation.Error = ""
+	if err := db.GetConn().Save(&rotation).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to store the rotation: %v", err))
+	}
+	log.Infof("[%v] started the rotation of the secret of %v, promoted at %v", username, alias.AliasName, rotation.PromoteAt.Time)
+	return c.JSON(http.StatusAccepted, toRotationResource(rotation))
+}
+
+/*PromoteSecrets promotes the next secrets whose grace period is over.
+It runs as a periodic job. A failed promotion is retried on the next run.
+The next secret is only deleted once the promotion is stored, so that a
+rotation left rotating can promote it again*/
+func PromoteSecrets() error {
+	var (
+		rotations []SecretRotation
+		failed    int
+	)
+	now := time.Now()
+	if err := db.GetConn().Where("state = ? AND promote_at <= ?", RotationRotating, now).
+		Find(&rotations).Error; err != nil {
+		return fmt.Errorf("failed to retrieve the rotations: %v", err)
+	}
+	for _, r := range rotations {
+		promoted := false
+		if err := promote(r.Alias); err != nil {
+			failed++
+			r.Error = err.Error()
+			log.Errorf("Failed to promote the secret of %v: %v", r.Alias, err)
+		} else {
+			promoted = true
+			r.State = RotationIdle
+			r.Error = ""
+			r.LastRotation = sql.NullTime{Time: now, Valid: true}
+			log.Infof("Promoted the next secret of %v", r.Alias)
+		}
+		if err := db.GetConn().Save(&r).Error; err != nil {
+			failed++
+			log.Errorf("Failed to store the rotation of %v: %v", r.Alias, err)
+			continue
+		}
+		if promoted {
+			//a leftover next secret is replaced by the next rotation
+			if err := auth.DeleteSecret(NextSecretName(r.Alias)); err != nil {
+				log.Errorf("Failed to delete the next secret of %v: %v", r.Alias, err)
+			}
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d secret promotions failed", failed)
+	}
+	return nil
+}
+
+//promote replaces the current secret with the next one
+func promote(aliasname string) error {
+	next := auth.GetSecret(NextSecretName(aliasname))
+	if next == "" {
+		return fmt.Errorf("the next secret is missing in tbag")
+	}
+	return auth.PostSecret(aliasname, next)
+}
@@ -0,0 +1,105 @@
+package ermis
+
+/*This file previews the nodes that the load balancer would currently pick for an alias.
+It applies the rules of lbd to the loads reported by the lbclients: the blacklisted
+nodes, the ones without a recent report and the ones with a negative load are left out,
+then the best_hosts nodes with the lowest load are picked, all of them for -1*/
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+//Reasons for leaving a node out of the selection
+const (
+	ExcludedBlacklisted = "blacklisted"
+	ExcludedNoReport    = "no load reported"
+	ExcludedStale       = "stale"
+	ExcludedNegative    = "negative load"
+	ExcludedNotBest     = "not among the best hosts"
+)
+
+type (
+	//Selection is the expected answer of the load balancer for an alias
+	Selection struct {
+		AliasName string         `json:"alias_name"`
+		BestHosts int            `json:"best_hosts"`
+		Selected  []SelectedNode `json:"selected"`
+		Excluded  []SelectedNode `json:"excluded"`
+		Time      time.Time      `json:"time"`
+	}
+	//SelectedNode describes a node in the selection, with the reason it was left out if so
+	SelectedNode struct {
+		NodeName       string     `json:"node_name"`
+		Load           int        `json:"load"`
+		LastLoadUpdate *time.Time `json:"last_load_update"`
+		Reason         string     `json:"reason,omitempty"`
+	}
+)
+
+//SelectBestHosts applies the selection rules of the load balancer to the nodes of the alias.
+//The nodes with the same load are ordered by name, while lbd picks among them at random
+func SelectBestHosts(alias Alias, now time.Time) Selection {
+	var candidates []SelectedNode
+	selection := Selection{
+		AliasName: alias.AliasName,
+		BestHosts: alias.BestHosts,
+		Selected:  []SelectedNode{},
+		Excluded:  []SelectedNode{},
+		Time:      now,
+	}
+	period := StalePeriod(alias)
+	for _, r := range alias.Relations {
+		node := SelectedNode{Load: r.Load}
+		if r.Node != nil {
+			node.NodeName = r.Node.NodeName
+		}
+		if r.LastLoadUpdate.Valid {
+			lastUpdate := r.LastLoadUpdate.Time
+			node.LastLoadUpdate = &lastUpdate
+		}
+		switch {
+		case r.Blacklist:
+			node.Reason = ExcludedBlacklisted
+		case !r.LastLoadUpdate.Valid:
+			node.Reason = ExcludedNoReport
+		case r.Stale || r.IsStale(period, now):
+			node.Reason = ExcludedStale
+		case r.Load < 0:
+			node.Reason = ExcludedNegative
+		}
+		if node.Reason != "" {
+			selection.Excluded = append(selection.Excluded, node)
+		} else {
+			candidates = append(candidates, node)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Load != candidates[j].Load {
+			return candidates[i].Load < candidates[j].Load
+		}
+		return candidates[i].NodeName < candidates[j].NodeName
+	})
+	for i, node := range candidates {
+		if alias.BestHosts == -1 || i < alias.BestHosts {
+			selection.Selected = append(selection.Selected, node)
+		} else {
+			node.Reason = ExcludedNotBest
+			selection.Excluded = append(selection.Excluded, node)
+		}
+	}
+	return selection
+}
+
+//GetBestHosts returns the nodes that the load balancer is expected to pick for an alias
+func GetBestHosts(c echo.Context) error {
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	log.Infof("[%v] is previewing the best hosts of %v", GetUsername(), retrieved.AliasName)
+	return c.JSON(http.StatusOK, SelectBestHosts(retrieved, time.Now()))
+}
@@ -0,0 +1,286 @@
+package ermis
+
+/*This file contains the states of the alarms, the history of their transitions
+and their silences. A silence covers the alarms of a hostgroup, an alias or a
+single alarm for a period of time. Silenced alarms are still evaluated and
+recorded, but their recipients are not notified*/
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+//SilenceResource binds and presents a silence in the API and UI
+type SilenceResource struct {
+	ID        int    `json:"silence_id"  form:"silence_id"`
+	AliasName string `json:"alias_name"  form:"alias_name"`
+	Hostgroup string `json:"hostgroup"   form:"hostgroup"`
+	AlarmID   int    `json:"alarm_id"    form:"alarm_id"`
+	Start     string `json:"start"       form:"start"`
+	End       string `json:"end"         form:"end"`
+	Creator   string `json:"creator"`
+	Reason    string `json:"reason"      form:"reason"`
+	Active    bool   `json:"active"`
+}
+
+//The states of an alarm. Unknown means that the last check could not be evaluated
+const (
+	StateOK      = "ok"
+	StateFiring  = "firing"
+	StateUnknown = "unknown"
+)
+
+//AlarmState names the state of an alarm from its active flag
+func AlarmState(active bool) string {
+	if active {
+		return StateFiring
+	}
+	return StateOK
+}
+
+//CurrentState returns the state of the alarm. The alarms checked before the states existed follow their active flag
+func (a Alarm) CurrentState() string {
+	if a.State == "" {
+		return AlarmState(a.Active)
+	}
+	return a.State
+}
+
+//GetAlarmHistory returns the state transitions of the alarms of an alias, newest first.
+//The since parameter(RFC3339 or YYYY-MM-DD) and the limit restrict the events returned
+func GetAlarmHistory(c echo.Context) error {
+	var events []AlarmEvent
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	query := db.GetConn().Where("alias=?", retrieved.AliasName).Order("time desc, id desc")
+	if since := c.QueryParam("since"); since != "" {
+		t, err := parseTime(since, time.Time{})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("wrong since parameter, %v", err))
+		}
+		query = query.Where("time >= ?", t)
+	}
+	limit := 100
+	if param := c.QueryParam("limit"); param != "" {
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				fmt.Sprintf("wrong limit parameter, received: %v", param))
+		}
+	}
+	if err := query.Limit(limit).Find(&events).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+
+	history := []map[string]interface{}{}
+	for _, e := range events {
+		history = append(history, map[string]interface{}{
+			"alarm_id":  e.AlarmID,
+			"name":      e.Name,
+			"time":      e.Time,
+			"old_state": e.OldState,
+			"new_state": e.NewState,
+			"value":     e.Value,
+			"silenced":  e.Silenced,
+		})
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+//Covers returns true if the silence applies to the alarm of the alias. A hostgroup covers its sub-hostgroups
+func (s Silence) Covers(alias Alias, alarm Alarm) bool {
+	return (alias.Hostgroup == s.Hostgroup || strings.HasPrefix(alias.Hostgroup, s.Hostgroup+"/")) &&
+		(s.Alias == "" || s.Alias == alias.AliasName) &&
+		(s.AlarmID == 0 || s.AlarmID == alarm.ID)
+}
+
+//ActiveAt returns true if the silence applies at the given time
+func (s Silence) ActiveAt(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+//ActiveSilences returns the silences that apply at the given time
+func ActiveSilences(t time.Time) (silences []Silence, err error) {
+	if err = db.GetConn().Where("`start` <= ? AND `end` > ?", t, t).Find(&silences).Error; err != nil {
+		return nil, fmt.Errorf("Failed in query: %v", err)
+	}
+	return silences, nil
+}
+
+//Silenced returns true if any of the silences covers the alarm of the alias
+func Silenced(silences []Silence, alias Alias, alarm Alarm) bool {
+	for _, s := range silences {
+		if s.Covers(alias, alarm) {
+			return true
+		}
+	}
+	return false
+}
+
+//toSilenceResource packages a silence for the reply
+func toSilenceResource(s Silence) SilenceResource {
+	return SilenceResource{
+		ID:        s.ID,
+		AliasName: s.Alias,
+		Hostgroup: s.Hostgroup,
+		AlarmID:   s.AlarmID,
+		Start:     s.Start.Format(time.RFC3339),
+		End:       s.End.Format(time.RFC3339),
+		Creator:   s.Creator,
+		Reason:    s.Reason,
+		Active:    s.ActiveAt(time.Now()),
+	}
+}
+
+//parseSilenceTime accepts RFC3339 and the format of the datetime-local inputs of the UI
+func parseSilenceTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("wrong time %v, expected RFC3339 or YYYY-MM-DDTHH:MM", value)
+}
+
+/*newSilence builds a silence from the request and resolves the hostgroup it covers.
+The alarm and alias of the silence must exist and agree with each other*/
+func newSilence(temp SilenceResource) (Silence, int, error) {
+	var err error
+	silence := Silence{
+		Hostgroup: temp.Hostgroup,
+		AlarmID:   temp.AlarmID,
+		Creator:   GetUsername(),
+		Reason:    temp.Reason,
+		Start:     time.Now(),
+	}
+	if temp.AliasName != "" {
+		silence.Alias = FullAliasName(temp.AliasName)
+	}
+	if temp.Start != "" {
+		if silence.Start, err = parseSilenceTime(temp.Start); err != nil {
+			return silence, http.StatusBadRequest, err
+		}
+	}
+	if silence.End, err = parseSilenceTime(temp.End); err != nil {
+		return silence, http.StatusBadRequest, err
+	}
+	if !silence.End.After(silence.Start) {
+		return silence, http.StatusBadRequest, fmt.Errorf("the end of the silence must be after its start")
+	}
+
+	if silence.AlarmID != 0 {
+		var alarm Alarm
+		if err := db.GetConn().Where("id=?", silence.AlarmID).Find(&alarm).Error; err != nil || alarm.ID == 0 {
+			return silence, http.StatusNotFound, fmt.Errorf("alarm %v does not exist", silence.AlarmID)
+		}
+		if silence.Alias != "" && silence.Alias != alarm.Alias {
+			return silence, http.StatusBadRequest,
+				fmt.Errorf("alarm %v does not belong to alias %v", silence.AlarmID, silence.Alias)
+		}
+		silence.Alias = alarm.Alias
+	}
+	if silence.Alias != "" {
+		retrieved, err := GetObjects(silence.Alias)
+		if err != nil {
+			return silence, http.StatusBadRequest, err
+		}
+		if len(retrieved) == 0 {
+			return silence, http.StatusNotFound, fmt.Errorf("the alias does not exist")
+		}
+		if silence.Hostgroup != "" && silence.Hostgroup != retrieved[0].Hostgroup {
+			return silence, http.StatusBadRequest,
+				fmt.Errorf("alias %v does not belong to hostgroup %v", silence.Alias, silence.Hostgroup)
+		}
+		silence.Hostgroup = retrieved[0].Hostgroup
+	}
+	if ok, err := govalidator.ValidateStruct(silence); err != nil || !ok {
+		return silence, http.StatusBadRequest, fmt.Errorf("not valid silence: %v", err)
+	}
+	return silence, http.StatusCreated, nil
+}
+
+//GetSilences returns the silences, optionally filtered by alias, hostgroup or only the active ones
+func GetSilences(c echo.Context) error {
+	var silences []Silence
+	query := db.GetConn().Order("`start` desc")
+	if alias := c.QueryParam("alias_name"); alias != "" {
+		query = query.Where("alias=?", FullAliasName(alias))
+	}
+	if hostgroup := c.QueryParam("hostgroup"); hostgroup != "" {
+		query = query.Where("hostgroup=?", hostgroup)
+	}
+	if c.QueryParam("active") == "true" {
+		now := time.Now()
+		query = query.Where("`start` <= ? AND `end` > ?", now, now)
+	}
+	if err := query.Find(&silences).Error; err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed in query: %v", err))
+	}
+	resources := []SilenceResource{}
+	for _, s := range silences {
+		resources = append(resources, toSilenceResource(s))
+	}
+	return c.JSON(http.StatusOK, resources)
+}
+
+//CreateSilence silences the alarms of a hostgroup, alias or single alarm
+func CreateSilence(c echo.Context) error {
+	var temp SilenceResource
+	username := GetUsername()
+	if err := c.Bind(&temp); err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("failed to bind parameters: %v", err), "silences.html")
+	}
+	defer c.Request().Body.Close()
+
+	silence, status, err := newSilence(temp)
+	if err != nil {
+		return MessageToUser(c, status, err.Error(), "silences.html")
+	}
+	if !isAuthorized("PATCH", "", silence.Hostgroup) {
+		return MessageToUser(c, http.StatusUnauthorized,
+			username+" is unauthorized to silence alarms in hostgroup "+silence.Hostgroup, "silences.html")
+	}
+	if err := db.GetConn().Create(&silence).Error; err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("failed to create the silence: %v", err), "silences.html")
+	}
+	return MessageToUser(c, http.StatusCreated,
+		fmt.Sprintf("silence %v created for hostgroup %v until %v", silence.ID, silence.Hostgroup,
+			silence.End.Format(time.RFC3339)), "silences.html")
+}
+
+//DeleteSilence removes a silence. The UI sends the id in the form, the CLI in the path
+func DeleteSilence(c echo.Context) error {
+	var silence Silence
+	username := GetUsername()
+	param := c.Param("id")
+	if param == "" {
+		param = c.FormValue("silence_id")
+	}
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("wrong silence id, received: %v", param), "silences.html")
+	}
+	if err := db.GetConn().Where("id=?", id).Find(&silence).Error; err != nil || silence.ID == 0 {
+		return MessageToUser(c, http.StatusNotFound, "silence not found", "silences.html")
+	}
+	if silence.Creator != username && !isAuthorized("DELETE", "", silence.Hostgroup) {
+		return MessageToUser(c, http.StatusUnauthorized,
+			username+" is unauthorized to DELETE in hostgroup "+silence.Hostgroup, "silences.html")
+	}
+	if err := db.GetConn().Delete(&silence).Error; err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("failed to delete the silence: %v", err), "silences.html")
+	}
+	return MessageToUser(c, http.StatusOK,
+		fmt.Sprintf("silence %v deleted successfully", silence.ID), "silences.html")
+}
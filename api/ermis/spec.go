@@ -0,0 +1,431 @@
+package ermis
+
+/*This file contains the declarative description of aliases(spec).
+Aliases can be exported in a stable YAML schema and the same document
+can be imported back. An import is first diffed against the DB(plan)
+and, if requested, applied through the normal create/modify/delete procedures*/
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+//SpecVersion is the version of the alias spec schema
+const SpecVersion = 1
+
+type (
+	//SpecDocument is the top level of an alias spec file.
+	//Hostgroup is the owner of the file, it is required by the reconciler
+	SpecDocument struct {
+		Version   int         `yaml:"version"              json:"version"`
+		Hostgroup string      `yaml:"hostgroup,omitempty"  json:"hostgroup,omitempty"`
+		Aliases   []AliasSpec `yaml:"aliases"              json:"aliases"`
+	}
+	//AliasSpec describes the managed fields of an alias
+	AliasSpec struct {
+		Name      string      `yaml:"name"        json:"name"`
+		Hostgroup string      `yaml:"hostgroup"   json:"hostgroup"`
+		View      string      `yaml:"view"        json:"view"`
+		BestHosts int         `yaml:"best_hosts"  json:"best_hosts"`
+		TTL       int         `yaml:"ttl"         json:"ttl"`
+		Nodes     []NodeSpec  `yaml:"nodes"       json:"nodes"`
+		Cnames    []string    `yaml:"cnames"      json:"cnames"`
+		Alarms    []AlarmSpec `yaml:"alarms"      json:"alarms"`
+	}
+	//NodeSpec describes a member of an alias
+	NodeSpec struct {
+		Name        string `yaml:"name"         json:"name"`
+		Blacklisted bool   `yaml:"blacklisted"  json:"blacklisted"`
+	}
+	//AlarmSpec describes an alarm of an alias
+	AlarmSpec struct {
+		Name      string `yaml:"name"       json:"name"`
+		Recipient string `yaml:"recipient"  json:"recipient"`
+		Parameter int    `yaml:"parameter"  json:"parameter"`
+	}
+	//PlannedChange describes what importing a spec changes for a single alias
+	PlannedChange struct {
+		AliasName string   `yaml:"alias_name"         json:"alias_name"`
+		Action    string   `yaml:"action"             json:"action"`
+		Changes   []string `yaml:"changes,omitempty"  json:"changes,omitempty"`
+		Status    int      `yaml:"status,omitempty"   json:"status,omitempty"`
+		Message   string   `yaml:"message,omitempty"  json:"message,omitempty"`
+		spec      AliasSpec
+		current   Alias
+	}
+	//Plan holds the changes of an import
+	Plan struct {
+		Applied bool            `yaml:"applied"  json:"applied"`
+		Changes []PlannedChange `yaml:"changes"  json:"changes"`
+	}
+)
+
+//ToSpec describes an alias with its spec, sorting every list for a stable output
+func ToSpec(alias Alias) AliasSpec {
+	spec := AliasSpec{
+		Name:      alias.AliasName,
+		Hostgroup: alias.Hostgroup,
+		View:      "internal",
+		BestHosts: alias.BestHosts,
+		TTL:       alias.TTL,
+		Nodes:     []NodeSpec{},
+		Cnames:    []string{},
+		Alarms:    []AlarmSpec{},
+	}
+	if alias.External == "yes" {
+		spec.View = "external"
+	}
+	for _, r := range alias.Relations {
+		spec.Nodes = append(spec.Nodes, NodeSpec{Name: r.Node.NodeName, Blacklisted: r.Blacklist})
+	}
+	for _, c := range alias.Cnames {
+		spec.Cnames = append(spec.Cnames, c.Cname)
+	}
+	for _, a := range alias.Alarms {
+		spec.Alarms = append(spec.Alarms, AlarmSpec{Name: a.Name, Recipient: a.Recipient, Parameter: a.Parameter})
+	}
+	return spec.normalize()
+}
+
+//normalize completes the alias name and sorts the lists, so that specs can be compared
+func (spec AliasSpec) normalize() AliasSpec {
+	spec.Name = FullAliasName(strings.ToLower(spec.Name))
+	spec.View = strings.ToLower(spec.View)
+	if StringInSlice(spec.View, []string{"yes", "external"}) {
+		spec.View = "external"
+	} else if StringInSlice(spec.View, []string{"no", "internal"}) {
+		spec.View = "internal"
+	}
+	sort.Slice(spec.Nodes, func(i, j int) bool { return spec.Nodes[i].Name < spec.Nodes[j].Name })
+	sort.Strings(spec.Cnames)
+	sort.Slice(spec.Alarms, func(i, j int) bool {
+		return spec.Alarms[i].String() < spec.Alarms[j].String()
+	})
+	return spec
+}
+
+//String returns the alarm in the name:recipient:parameter format of the alias resource
+func (a AlarmSpec) String() string {
+	return a.Name + ":" + a.Recipient + ":" + strconv.Itoa(a.Parameter)
+}
+
+//toResource turns a spec into the resource binded by the create/modify procedures
+func (spec AliasSpec) toResource() Resource {
+	resource := Resource{
+		AliasName:      spec.Name,
+		Hostgroup:      spec.Hostgroup,
+		External:       spec.View,
+		BestHosts:      spec.BestHosts,
+		TTL:            spec.TTL,
+		Cnames:         spec.Cnames,
+		AllowedNodes:   []string{},
+		ForbiddenNodes: []string{},
+		Alarms:         []string{},
+	}
+	for _, n := range spec.Nodes {
+		if n.Blacklisted {
+			resource.ForbiddenNodes = append(resource.ForbiddenNodes, n.Name)
+		} else {
+			resource.AllowedNodes = append(resource.AllowedNodes, n.Name)
+		}
+	}
+	for _, a := range spec.Alarms {
+		resource.Alarms = append(resource.Alarms, a.String())
+	}
+	return resource
+}
+
+/*DiffSpec lists the differences between the current and the desired spec of an alias.
+Zero values in the desired single-valued fields mean that the field is not managed
+by the spec, exactly like the zero values of a PATCH request*/
+func DiffSpec(current, desired AliasSpec) (changes []string) {
+	current = current.normalize()
+	desired = desired.normalize()
+	if desired.Hostgroup != "" && desired.Hostgroup != current.Hostgroup {
+		changes = append(changes, fmt.Sprintf("hostgroup: %v -> %v", current.Hostgroup, desired.Hostgroup))
+	}
+	if desired.View != "" && desired.View != current.View {
+		changes = append(changes, fmt.Sprintf("view: %v -> %v", current.View, desired.View))
+	}
+	if desired.BestHosts != 0 && desired.BestHosts != current.BestHosts {
+		changes = append(changes, fmt.Sprintf("best_hosts: %v -> %v", current.BestHosts, desired.BestHosts))
+	}
+	if desired.TTL != 0 && desired.TTL != current.TTL {
+		changes = append(changes, fmt.Sprintf("ttl: %v -> %v", current.TTL, desired.TTL))
+	}
+
+	currentNodes := make(map[string]bool)
+	for _, n := range current.Nodes {
+		currentNodes[n.Name] = n.Blacklisted
+	}
+	desiredNodes := make(map[string]bool)
+	for _, n := range desired.Nodes {
+		desiredNodes[n.Name] = n.Blacklisted
+		if blacklisted, found := currentNodes[n.Name]; !found {
+			changes = append(changes, fmt.Sprintf("add node %v (blacklisted: %v)", n.Name, n.Blacklisted))
+		} else if blacklisted != n.Blacklisted {
+			changes = append(changes, fmt.Sprintf("node %v blacklisted: %v -> %v", n.Name, blacklisted, n.Blacklisted))
+		}
+	}
+	for _, n := range current.Nodes {
+		if _, found := desiredNodes[n.Name]; !found {
+			changes = append(changes, fmt.Sprintf("remove node %v", n.Name))
+		}
+	}
+
+	changes = append(changes, diffLists("cname", current.Cnames, desired.Cnames)...)
+
+	var currentAlarms, desiredAlarms []string
+	for _, a := range current.Alarms {
+		currentAlarms = append(currentAlarms, a.String())
+	}
+	for _, a := range desired.Alarms {
+		desiredAlarms = append(desiredAlarms, a.String())
+	}
+	changes = append(changes, diffLists("alarm", currentAlarms, desiredAlarms)...)
+
+	return changes
+}
+
+//diffLists reports the elements that have to be added and removed to reach the desired list
+func diffLists(kind string, current, desired []string) (changes []string) {
+	for _, d := range desired {
+		if !StringInSlice(d, current) {
+			changes = append(changes, fmt.Sprintf("add %v %v", kind, d))
+		}
+	}
+	for _, c := range current {
+		if !StringInSlice(c, desired) {
+			changes = append(changes, fmt.Sprintf("remove %v %v", kind, c))
+		}
+	}
+	return changes
+}
+
+/*PlanSpecs compares a spec document with the existing aliases. With prune, the aliases
+that belong to the hostgroups of the document but are not described by it are deleted*/
+func PlanSpecs(doc SpecDocument, existing []Alias, prune bool) (plan Plan, err error) {
+	current := make(map[string]Alias)
+	for _, alias := range existing {
+		current[alias.AliasName] = alias
+	}
+	described := make(map[string]bool)
+	hostgroups := []string{}
+
+	for _, spec := range doc.Aliases {
+		spec = spec.normalize()
+		if described[spec.Name] {
+			return Plan{}, fmt.Errorf("alias %v is described more than once", spec.Name)
+		}
+		described[spec.Name] = true
+		if spec.Hostgroup != "" && !StringInSlice(spec.Hostgroup, hostgroups) {
+			hostgroups = append(hostgroups, spec.Hostgroup)
+		}
+
+		change := PlannedChange{AliasName: spec.Name, spec: spec}
+		if alias, found := current[spec.Name]; found {
+			change.current = alias
+			change.Changes = DiffSpec(ToSpec(alias), spec)
+			change.Action = "update"
+			if len(change.Changes) == 0 {
+				change.Action = "none"
+			}
+		} else {
+			change.Action = "create"
+			change.Changes = DiffSpec(AliasSpec{}, spec)
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	if prune {
+		for _, alias := range existing {
+			if !described[alias.AliasName] && StringInSlice(alias.Hostgroup, hostgroups) {
+				plan.Changes = append(plan.Changes, PlannedChange{
+					AliasName: alias.AliasName,
+					Action:    "delete",
+					current:   alias,
+				})
+			}
+		}
+	}
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].AliasName < plan.Changes[j].AliasName
+	})
+	return plan, nil
+}
+
+//authorize checks that the current user can apply a planned change
+func (change PlannedChange) authorize() (int, error) {
+	switch change.Action {
+	case "create":
+		if !isAuthorized("POST", change.spec.Hostgroup, "") {
+			return http.StatusUnauthorized,
+				fmt.Errorf("%v is unauthorized to POST in hostgroup %v", GetUsername(), change.spec.Hostgroup)
+		}
+	case "update":
+		if !isAuthorized("PATCH", change.spec.Hostgroup, change.current.Hostgroup) {
+			return http.StatusUnauthorized,
+				fmt.Errorf("%v is unauthorized to PATCH in hostgroup %v", GetUsername(), change.current.Hostgroup)
+		}
+	case "delete":
+		if !isAuthorized("DELETE", "", change.current.Hostgroup) {
+			return http.StatusUnauthorized,
+				fmt.Errorf("%v is unauthorized to DELETE from hostgroup %v", GetUsername(), change.current.Hostgroup)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+//apply runs the create/modify/delete procedure of a planned change, on behalf of user
+func (change *PlannedChange) apply(user string) {
+	var (
+		status int
+		err    error
+	)
+	switch change.Action {
+	case "none":
+		change.Status = http.StatusOK
+		change.Message = "nothing to do"
+		return
+	case "create":
+		var alias Alias
+		if alias, err = prepareCreation("application/json", change.spec.toResource()); err != nil {
+			status = http.StatusBadRequest
+			break
+		}
+		alias.User = user
+		if status, err = alias.applyCreation(); err != nil {
+			break
+		}
+		//Creation only sets the cnames, the nodes, alarms and ttl are set with a modification
+		if len(change.spec.Nodes) == 0 && len(change.spec.Alarms) == 0 && change.spec.TTL == 0 {
+			break
+		}
+		var created []Alias
+		if created, err = GetObjects(alias.AliasName); err != nil || len(created) == 0 {
+			status, err = http.StatusBadRequest,
+				fmt.Errorf("alias %v was created, but could not be retrieved to set its nodes and alarms: %v", alias.AliasName, err)
+			break
+		}
+		if alias, err = prepareModification("application/json", created[0], change.spec.toResource()); err != nil {
+			status = http.StatusBadRequest
+			break
+		}
+		alias.User = user
+		if status, err = alias.applyModification(created[0]); err == nil {
+			status = http.StatusCreated
+		}
+	case "update":
+		var alias Alias
+		if alias, err = prepareModification("application/json", change.current, change.spec.toResource()); err != nil {
+			status = http.StatusBadRequest
+			break
+		}
+		alias.User = user
+		status, err = alias.applyModification(change.current)
+	case "delete":
+		status, err = change.current.applyDeletion()
+	}
+	change.Status = status
+	if err != nil {
+		change.Message = err.Error()
+		return
+	}
+	change.Message = "applied successfully"
+}
+
+//ExportAliases returns the spec of all aliases(or of a single alias/hostgroup) in YAML or JSON
+func ExportAliases(c echo.Context) error {
+	queryResults, err := get(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	hostgroup := c.QueryParam("hostgroup")
+	doc := SpecDocument{Version: SpecVersion, Hostgroup: hostgroup, Aliases: []AliasSpec{}}
+	for _, alias := range queryResults {
+		if hostgroup == "" || alias.Hostgroup == hostgroup {
+			doc.Aliases = append(doc.Aliases, ToSpec(alias))
+		}
+	}
+	log.Infof("[%v] exported the spec of %v aliases", GetUsername(), len(doc.Aliases))
+	return renderSpec(c, http.StatusOK, doc)
+}
+
+/*ImportAliases diffs a spec document against the DB. With mode=apply the changes
+are applied, every alias being authorized separately*/
+func ImportAliases(c echo.Context) error {
+	var doc SpecDocument
+	username := GetUsername()
+
+	raw, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	defer c.Request().Body.Close()
+	//JSON documents are valid YAML as well
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to decode the spec document: %v", err))
+	}
+	if doc.Version != SpecVersion {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("unsupported spec version %v, expected %v", doc.Version, SpecVersion))
+	}
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = "plan"
+	}
+	if !StringInSlice(mode, []string{"plan", "apply"}) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("unknown mode %v, expected plan or apply", mode))
+	}
+
+	existing, err := GetObjects("all")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	plan, err := PlanSpecs(doc, existing, c.QueryParam("prune") == "true")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	log.Infof("[%v] planned the import of %v aliases", username, len(plan.Changes))
+
+	if mode == "apply" {
+		failed := false
+		for i := range plan.Changes {
+			if status, err := plan.Changes[i].authorize(); err != nil {
+				plan.Changes[i].Status = status
+				plan.Changes[i].Message = err.Error()
+			} else {
+				plan.Changes[i].apply(username)
+			}
+			if plan.Changes[i].Status >= 300 {
+				failed = true
+			}
+		}
+		plan.Applied = true
+		log.Infof("[%v] applied the import of %v aliases", username, len(plan.Changes))
+		if failed {
+			return renderSpec(c, http.StatusMultiStatus, plan)
+		}
+	}
+	return renderSpec(c, http.StatusOK, plan)
+}
+
+//renderSpec replies in YAML, unless JSON is asked with format=json
+func renderSpec(c echo.Context, status int, i interface{}) error {
+	if c.QueryParam("format") == "json" {
+		return c.JSON(status, i)
+	}
+	out, err := yaml.Marshal(i)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.Blob(status, "application/yaml", out)
+}
@@ -0,0 +1,274 @@
+package ermis
+
+/*This file contains the handlers of the alias sub-resources(cnames and alarms).
+They apply a single change to the DB and DNS, without resending the whole alias.
+Authorization is done by the middleware, against the hostgroup of the parent alias*/
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+type (
+	//AlarmResource describes a single alarm of an alias
+	AlarmResource struct {
+		ID         int        `json:"alarm_id"`
+		Name       string     `json:"name"`
+		Recipient  string     `json:"recipient"`
+		Parameter  *int       `json:"parameter"`
+		Active     bool       `json:"active"`
+		State      string     `json:"state"`
+		LastCheck  *time.Time `json:"last_check,omitempty"`
+		LastActive *time.Time `json:"last_active,omitempty"`
+	}
+)
+
+//ParentAlias retrieves the alias that the sub-resource belongs to
+func ParentAlias(c echo.Context) (Alias, int, error) {
+	param := c.Param("id")
+	if _, err := strconv.Atoi(param); err != nil {
+		param = FullAliasName(param)
+	}
+	retrieved, err := GetObjects(param)
+	if err != nil {
+		return Alias{}, http.StatusBadRequest, err
+	}
+	if len(retrieved) == 0 {
+		return Alias{}, http.StatusNotFound, fmt.Errorf("the alias does not exist")
+	}
+	return retrieved[0], http.StatusOK, nil
+}
+
+//toAlarmResource packages an alarm for the reply
+func toAlarmResource(alarm Alarm) AlarmResource {
+	parameter := alarm.Parameter
+	resource := AlarmResource{
+		ID:        alarm.ID,
+		Name:      alarm.Name,
+		Recipient: alarm.Recipient,
+		Parameter: &parameter,
+		Active:    alarm.Active,
+		State:     alarm.CurrentState(),
+	}
+	if alarm.LastCheck.Valid {
+		resource.LastCheck = &alarm.LastCheck.Time
+	}
+	if alarm.LastActive.Valid {
+		resource.LastActive = &alarm.LastActive.Time
+	}
+	return resource
+}
+
+//AddCname adds a single cname to an alias
+func AddCname(c echo.Context) error {
+	username := GetUsername()
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return MessageToUser(c, status, err.Error(), "home.html")
+	}
+	cname := Cname{CnameAliasID: retrieved.ID, Cname: c.Param("cname")}
+	if ok, err := govalidator.ValidateStruct(cname); err != nil || !ok {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("not valid cname %v: %v", cname.Cname, err), "home.html")
+	}
+	if Contains(cname, retrieved.Cnames) {
+		return MessageToUser(c, http.StatusConflict,
+			fmt.Sprintf("cname %v already exists in alias %v", cname.Cname, retrieved.AliasName), "home.html")
+	}
+	log.Infof("[%v] adding cname %v to alias %v", username, cname.Cname, retrieved.AliasName)
+
+	updated := retrieved
+	updated.User = username
+	updated.Cnames = append(append([]Cname{}, retrieved.Cnames...), cname)
+	if err := addCnameTransactions(db.GetConn(), cname); err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("failed to add cname %v in the database: %v", cname.Cname, err), "home.html")
+	}
+	if err := updated.updateCnamesInDNS(retrieved.Cnames); err != nil {
+		//updateCnames brings the DB back to the cnames of the retrieved alias
+		if rberr := retrieved.updateCnames(db.GetConn()); rberr != nil {
+			log.Errorf("[%v] failed to roll back cname %v of alias %v: %v", username, cname.Cname, retrieved.AliasName, rberr)
+		}
+		return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
+	}
+	return MessageToUser(c, http.StatusCreated,
+		fmt.Sprintf("cname %v added to %v successfully", cname.Cname, retrieved.AliasName), "home.html")
+}
+
+//RemoveCname removes a single cname from an alias
+func RemoveCname(c echo.Context) error {
+	var (
+		found   *Cname
+		updated = []Cname{}
+	)
+	username := GetUsername()
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return MessageToUser(c, status, err.Error(), "home.html")
+	}
+	for i, v := range retrieved.Cnames {
+		if v.Cname == c.Param("cname") {
+			found = &retrieved.Cnames[i]
+			continue
+		}
+		updated = append(updated, v)
+	}
+	if found == nil {
+		return MessageToUser(c, http.StatusNotFound,
+			fmt.Sprintf("cname %v does not exist in alias %v", c.Param("cname"), retrieved.AliasName), "home.html")
+	}
+	log.Infof("[%v] removing cname %v from alias %v", username, found.Cname, retrieved.AliasName)
+
+	if err := deleteCnameTransactions(db.GetConn(), *found); err != nil {
+		return MessageToUser(c, http.StatusBadRequest,
+			fmt.Sprintf("failed to delete cname %v from the database: %v", found.Cname, err), "home.html")
+	}
+	alias := retrieved
+	alias.User = username
+	alias.Cnames = updated
+	if err := alias.updateCnamesInDNS(retrieved.Cnames); err != nil {
+		if rberr := addCnameTransactions(db.GetConn(), Cname{CnameAliasID: retrieved.ID, Cname: found.Cname}); rberr != nil {
+			log.Errorf("[%v] failed to roll back cname %v of alias %v: %v", username, found.Cname, retrieved.AliasName, rberr)
+		}
+		return MessageToUser(c, http.StatusBadRequest, err.Error(), "home.html")
+	}
+	return MessageToUser(c, http.StatusOK,
+		fmt.Sprintf("cname %v removed from %v successfully", found.Cname, retrieved.AliasName), "home.html")
+}
+
+//GetAlarms returns the alarms of an alias, with the IDs used by the alarm sub-resource
+func GetAlarms(c echo.Context) error {
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	alarms := []AlarmResource{}
+	for _, alarm := range retrieved.Alarms {
+		alarms = append(alarms, toAlarmResource(alarm))
+	}
+	return c.JSON(http.StatusOK, alarms)
+}
+
+//AddAlarm adds a single alarm to an alias
+func AddAlarm(c echo.Context) error {
+	var temp AlarmResource
+	username := GetUsername()
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	if err := c.Bind(&temp); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to bind parameters: %v", err))
+	}
+	defer c.Request().Body.Close()
+	if temp.Parameter == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "alarm parameter is missing")
+	}
+
+	alarm := Alarm{
+		AlarmAliasID: retrieved.ID,
+		Alias:        retrieved.AliasName,
+		Name:         temp.Name,
+		Recipient:    temp.Recipient,
+		Parameter:    *temp.Parameter,
+	}
+	if ok, err := govalidator.ValidateStruct(alarm); err != nil || !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("not valid alarm: %v", err))
+	}
+	if Contains(alarm, retrieved.Alarms) {
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("alarm already exists in alias %v", retrieved.AliasName))
+	}
+	log.Infof("[%v] adding alarm %v:%v:%v to alias %v",
+		username, alarm.Name, alarm.Recipient, alarm.Parameter, retrieved.AliasName)
+
+	if err := addAlarmTransactions(db.GetConn(), &alarm); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to add the alarm in the database: %v", err))
+	}
+	return c.JSON(http.StatusCreated, toAlarmResource(alarm))
+}
+
+//ModifyAlarm changes the name, recipient or parameter of a single alarm
+func ModifyAlarm(c echo.Context) error {
+	var temp AlarmResource
+	username := GetUsername()
+	retrieved, alarm, status, err := findAlarm(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	if err := c.Bind(&temp); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to bind parameters: %v", err))
+	}
+	defer c.Request().Body.Close()
+
+	//Only the provided fields are modified
+	if temp.Name != "" {
+		alarm.Name = temp.Name
+	}
+	if temp.Recipient != "" {
+		alarm.Recipient = temp.Recipient
+	}
+	if temp.Parameter != nil {
+		alarm.Parameter = *temp.Parameter
+	}
+	if ok, err := govalidator.ValidateStruct(alarm); err != nil || !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("not valid alarm: %v", err))
+	}
+	for _, other := range retrieved.Alarms {
+		if other.ID != alarm.ID && Contains(alarm, []Alarm{other}) {
+			return echo.NewHTTPError(http.StatusConflict,
+				fmt.Sprintf("alarm already exists in alias %v", retrieved.AliasName))
+		}
+	}
+	log.Infof("[%v] modifying alarm %v of alias %v to %v:%v:%v",
+		username, alarm.ID, retrieved.AliasName, alarm.Name, alarm.Recipient, alarm.Parameter)
+
+	if err := updateAlarmTransactions(alarm); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to update the alarm in the database: %v", err))
+	}
+	return c.JSON(http.StatusAccepted, toAlarmResource(alarm))
+}
+
+//RemoveAlarm removes a single alarm from an alias
+func RemoveAlarm(c echo.Context) error {
+	username := GetUsername()
+	retrieved, alarm, status, err := findAlarm(c)
+	if err != nil {
+		return echo.NewHTTPError(status, err.Error())
+	}
+	log.Infof("[%v] removing alarm %v from alias %v", username, alarm.ID, retrieved.AliasName)
+	if err := deleteAlarmTransactions(db.GetConn(), alarm); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("failed to delete the alarm from the database: %v", err))
+	}
+	return c.JSON(http.StatusOK, toAlarmResource(alarm))
+}
+
+//findAlarm retrieves the parent alias and the alarm addressed by the request
+func findAlarm(c echo.Context) (Alias, Alarm, int, error) {
+	retrieved, status, err := ParentAlias(c)
+	if err != nil {
+		return Alias{}, Alarm{}, status, err
+	}
+	id, err := strconv.Atoi(c.Param("alarm"))
+	if err != nil {
+		return Alias{}, Alarm{}, http.StatusBadRequest,
+			fmt.Errorf("wrong alarm id, received: %v", c.Param("alarm"))
+	}
+	for _, alarm := range retrieved.Alarms {
+		if alarm.ID == id {
+			return retrieved, alarm, http.StatusOK, nil
+		}
+	}
+	return Alias{}, Alarm{}, http.StatusNotFound,
+		fmt.Errorf("alarm %v does not exist in alias %v", id, retrieved.AliasName)
+}
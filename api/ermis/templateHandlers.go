@@ -32,6 +32,11 @@ func LogsHandler(c echo.Context) error {
 	return MessageToUser(c, 200, "", "logs.html")
 }
 
+//SilencesHandler handles the alarm silences page
+func SilencesHandler(c echo.Context) error {
+	return MessageToUser(c, 200, "", "silences.html")
+}
+
 //ModifyHandler handles modify page
 func ModifyHandler(c echo.Context) error {
 	return MessageToUser(c, 200, "", "modify.html")
@@ -11,24 +11,30 @@ import (
 )
 
 //CreateTransactions creates a new DB entry and its cname relations, with transactions
-func CreateTransactions(alias Alias) (err error) {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func CreateTransactions(conn *gorm.DB, alias Alias) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 
 		if err = tx.Where("alias_name=?", alias.AliasName).
 			Create(&alias).
 			Error; err != nil {
-			tx.Rollback() // rollback
 			return errors.New(alias.AliasName + " creation in DB failed with error: " +
 				err.Error())
 		}
+		//The create skips the false value in favour of the column default, true
+		if !alias.LegacyAuth {
+			if err = tx.Model(&alias).Update("legacy_auth", false).Error; err != nil {
+				return errors.New(alias.AliasName + " creation in DB failed with error: " +
+					err.Error())
+			}
+		}
 		return nil
 	})
 }
 
 //aliasUpdateTransactions updates non-associative alias parameters
 //(best hosts, behaviour, hostgroup, metric, tenant etc.)
-func aliasUpdateTransactions(a Alias) (err error) {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func aliasUpdateTransactions(conn *gorm.DB, a Alias) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		if err = tx.Model(&a).Omit(clause.Associations).Updates(
 			map[string]interface{}{
 				"external":          a.External,
@@ -38,6 +44,8 @@ func aliasUpdateTransactions(a Alias) (err error) {
 				"polling_interval":  a.PollingInterval,
 				"ttl":               a.TTL,
 				"tenant":            a.Tenant,
+				"legacy_auth":       a.LegacyAuth,
+				"stale_period":      a.StalePeriod,
 				"last_modification": time.Now(),
 			}).Error; err != nil {
 			return errors.New("Failed to update the single-valued fields with error: " + err.Error())
@@ -47,9 +55,9 @@ func aliasUpdateTransactions(a Alias) (err error) {
 	})
 }
 
-//deleteTransactions deletes an entry and its relations from DB, with transactions
-func deleteTransactions(alias Alias) (err error) {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+//DeleteTransactions deletes an entry and its relations from DB, with transactions
+func DeleteTransactions(conn *gorm.DB, alias Alias) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		if tx.Select(clause.Associations).
 			Where("alias_name=? OR id=?", alias.AliasName, alias.ID).
 			Delete(&alias); err != nil {
@@ -57,6 +65,13 @@ func deleteTransactions(alias Alias) (err error) {
 
 		}
 
+		//The load history goes with the alias
+		if err = tx.Where("alias_id = ?", alias.ID).
+			Delete(&LoadSample{}).
+			Error; err != nil {
+			return errors.New("Failed to delete the load history with error: " + err.Error())
+		}
+
 		//Delete node with no other relations
 		for _, relation := range alias.Relations {
 			if tx.Model(&relation.Node).Association("Aliases").Count() == 0 {
@@ -77,21 +92,19 @@ func deleteTransactions(alias Alias) (err error) {
 }
 
 //deleteNodeTransactions deletes  a Node from the database
-func deleteNodeTransactions(v Relation) (err error) {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func deleteNodeTransactions(conn *gorm.DB, v Relation) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		//Delete relation
 		if err = tx.Set("gorm:association_autoupdate", false).
 			Where("alias_id = ? AND node_id = ?", v.AliasID, v.NodeID).
 			Delete(&Relation{}).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		//Delete node with no other relations
 		if tx.Model(&v.Node).Association("Aliases").Count() == 0 {
 			if err = tx.Delete(&v.Node).
 				Error; err != nil {
-				tx.Rollback()
 				return err
 
 			}
@@ -104,15 +117,14 @@ func deleteNodeTransactions(v Relation) (err error) {
 }
 
 //addNodeTransactions adds a node in the DB
-func AddNodeTransactions(v Relation) (err error) {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func AddNodeTransactions(conn *gorm.DB, v Relation) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		//Either create a new node or find an existing one
 		//Remember that its a many-2-many relationship, so nodes
 		//can exist already, assigned to another alias
 		if err = tx.Where("node_name = ?", v.Node.NodeName).
 			FirstOrCreate(&v.Node).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		//Create the relationship for that alias and the
@@ -126,7 +138,6 @@ func AddNodeTransactions(v Relation) (err error) {
 				LastLoadUpdate: v.LastLoadUpdate,
 			},
 		).Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 
@@ -134,15 +145,40 @@ func AddNodeTransactions(v Relation) (err error) {
 	})
 }
 
-//updatePrivilegeTransactions updates the privilege of a node from allowed to forbidden and vice versa
-func updatePrivilegeTransactions(v Relation) (err error) {
+//AddNodeInAliasesTransactions finds or creates a node and relates it with several aliases at once
+func AddNodeInAliasesTransactions(node Node, relations []Relation) (err error) {
+	if len(relations) == 0 {
+		return nil
+	}
 	return WithinTransaction(func(tx *gorm.DB) (err error) {
+		if err = tx.Where("node_name = ?", node.NodeName).
+			FirstOrCreate(&node).
+			Error; err != nil {
+			return err
+		}
+		for i := range relations {
+			relations[i].NodeID = node.ID
+		}
+		//A single insert for all the relations
+		if err = tx.Omit("Node", "Alias").Create(&relations).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+//updatePrivilegeTransactions updates the privilege of a node from allowed to forbidden and vice versa
+func updatePrivilegeTransactions(conn *gorm.DB, v Relation) (err error) {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		//Update single column blacklist in Relations table
 		if err = tx.Model(&v).
 			Where("alias_id=? AND node_id = ?", v.AliasID, v.NodeID).
-			Update("blacklist", v.Blacklist).
+			Updates(map[string]interface{}{
+				"blacklist": v.Blacklist,
+				//a manual change takes precedence over the automatic blacklist of the stale nodes
+				"auto_blacklisted": false,
+			}).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 
@@ -152,10 +188,9 @@ func updatePrivilegeTransactions(v Relation) (err error) {
 }
 
 //AddCnameTransactions appends a Cname
-func addCnameTransactions(cname Cname) error {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func addCnameTransactions(conn *gorm.DB, cname Cname) error {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		if err = tx.Create(&cname).Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		return nil
@@ -165,11 +200,10 @@ func addCnameTransactions(cname Cname) error {
 
 //DeleteCnameTransactions cname from db during modification
 //AutoUpdate is false, because otherwise we will be adding what we just deleted
-func deleteCnameTransactions(cname Cname) error {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func deleteCnameTransactions(conn *gorm.DB, cname Cname) error {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		if err = tx.Delete(&cname).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		return nil
@@ -178,12 +212,25 @@ func deleteCnameTransactions(cname Cname) error {
 
 }
 
-//addAlarmTransactions appends an alarm
-func addAlarmTransactions(alarm Alarm) error {
+//addAlarmTransactions appends an alarm, its ID is set once created
+func addAlarmTransactions(conn *gorm.DB, alarm *Alarm) error {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
+		if err = tx.Create(alarm).
+			Error; err != nil {
+			return err
+		}
+		return nil
+	})
+
+}
+
+//updateAlarmTransactions saves the changes of an existing alarm
+func updateAlarmTransactions(alarm Alarm) error {
 	return WithinTransaction(func(tx *gorm.DB) (err error) {
-		if err = tx.Create(&alarm).
+		if err = tx.Model(&alarm).
+			Select("name", "recipient", "parameter").
+			Updates(alarm).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		return nil
@@ -193,11 +240,10 @@ func addAlarmTransactions(alarm Alarm) error {
 
 //deleteAlarmTransactions deletes an alarm from db during modification
 //AutoUpdate is false, because otherwise we will be adding what we just deleted
-func deleteAlarmTransactions(alarm Alarm) error {
-	return WithinTransaction(func(tx *gorm.DB) (err error) {
+func deleteAlarmTransactions(conn *gorm.DB, alarm Alarm) error {
+	return withinTransaction(conn, func(tx *gorm.DB) (err error) {
 		if err = tx.Delete(&alarm).
 			Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 		return nil
@@ -208,13 +254,12 @@ func deleteAlarmTransactions(alarm Alarm) error {
 
 // WithinTransaction  accept dBFunc as parameter call dBFunc function within transaction begin, and commit and return error from dBFunc
 func WithinTransaction(fn dBFunc) (err error) {
-	tx := db.GetConn().Begin() // start db transaction
-	defer tx.Commit()
-	err = fn(tx)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	return nil
+	return withinTransaction(db.GetConn(), fn)
+}
 
+/*withinTransaction calls fn within a transaction of conn, committed unless fn fails.
+If conn is already a transaction, fn runs in a savepoint of it. This way the operations
+of a bulk request are applied in a single transaction*/
+func withinTransaction(conn *gorm.DB, fn dBFunc) error {
+	return conn.Transaction(fn)
 }
@@ -52,3 +52,8 @@ func GetUsername() string {
 func IsSuperuser() bool {
 	return currentUser.Superuser
 }
+
+//SetUserProfile replaces the profile of the current user, without querying teigi
+func SetUserProfile(profile User) {
+	currentUser = profile
+}
@@ -1,8 +1,11 @@
 package lbclient
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
@@ -13,10 +16,29 @@ var (
 	log = bootstrap.GetLog()
 )
 
+//The outcomes of the aliases of a report
+const (
+	Updated      = "updated"
+	Registered   = "registered"
+	Unauthorized = "unauthorized"
+	UnknownAlias = "unknown_alias"
+	Failed       = "failed"
+)
+
 type LBClient struct {
 	NodeName string
 	Status   []Status
 	Aliases  []ermis.Alias
+	//The signed reports keep the raw body, its timestamp and signatures
+	body       []byte
+	timestamp  string
+	signatures map[string]string
+	freshness  error
+	//The aliases whose secret is rotating also accept the next secret,
+	//the ones promoted recently the secret found in tbag besides the cached one
+	rotating map[string]string
+	//The loads applied, kept in the load history
+	samples []ermis.LoadSample
 }
 type Status struct {
 	AliasName string
@@ -24,11 +46,56 @@ type Status struct {
 	Load      int
 }
 
+//AliasOutcome tells the node what happened with one of the aliases it reported
+type AliasOutcome struct {
+	AliasName string `json:"alias_name"`
+	Result    string `json:"result"`
+	Message   string `json:"message,omitempty"`
+}
+
+//Report is the reply to the node, with the outcome of every alias it reported
+type Report struct {
+	NodeName string         `json:"node_name"`
+	Aliases  []AliasOutcome `json:"aliases"`
+}
+
+/*status is 200 if any alias was registered or updated. Otherwise it
+reflects the problem of the aliases, from the most to the least severe*/
+func (r Report) status() int {
+	found := make(map[string]bool)
+	for _, o := range r.Aliases {
+		found[o.Result] = true
+	}
+	switch {
+	case found[Updated] || found[Registered]:
+		return http.StatusOK
+	case found[Failed]:
+		return http.StatusBadRequest
+	case found[Unauthorized]:
+		return http.StatusUnauthorized
+	}
+	return http.StatusNotFound
+}
+
+//PostHandler receives the load of a node in its aliases. Every alias is processed independently
 func PostHandler(c echo.Context) error {
 	var (
 		lbclient LBClient
 	)
 
+	//Keep the raw body for the signatures, and restore it so we can bind it
+	raw, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return messageToNode(http.StatusBadRequest, fmt.Sprintf("failed to read the report, error:%v", err))
+	}
+	c.Request().Body = ioutil.NopCloser(bytes.NewBuffer(raw))
+	lbclient.body = raw
+	if header := c.Request().Header.Get(SignatureHeader); header != "" {
+		lbclient.timestamp = c.Request().Header.Get(TimestampHeader)
+		lbclient.signatures = parseSignatures(header)
+		lbclient.freshness = checkFreshness(lbclient.timestamp, time.Now())
+	}
+
 	if err := c.Bind(&lbclient.Status); err != nil {
 		return messageToNode(http.StatusBadRequest, fmt.Sprintf("failed in Bind for handler Update LBClient, error:%v", err))
 
@@ -44,46 +111,20 @@ func PostHandler(c echo.Context) error {
 	if err := lbclient.findAliases(); err != nil {
 		return messageToNode(http.StatusBadRequest, fmt.Sprintf("failed to find reported aliases in database; %v", err))
 	}
-	//make sure the reported aliases exist
-	if len(lbclient.Aliases) == 0 {
-		return messageToNode(http.StatusNotFound, fmt.Sprintf("there are no aliases for node %v", lbclient.NodeName))
-	}
 
-	log.Infof(" checking if node %v its registered on every alias", lbclient.NodeName)
-	unreg, err := lbclient.findUnregistered()
-	if err != nil {
-		return messageToNode(http.StatusBadRequest, fmt.Sprintf("error while looking for the aliases where node %v is unregistered, error: %v", lbclient.NodeName, err))
+	report := Report{NodeName: lbclient.NodeName, Aliases: lbclient.process()}
+	if report.Aliases == nil {
+		report.Aliases = []AliasOutcome{}
 	}
-
-	if len(unreg) != 0 {
-		log.Infof("preparing to register node %v in the following aliases:%v", lbclient.NodeName, unreg)
-		if status, err := lbclient.registerNode(unreg); err != nil {
-			return messageToNode(status, fmt.Sprintf("error while registering node %v error: %v", lbclient.NodeName, err))
-		}
+	status := report.status()
+	if status == http.StatusOK {
+		log.Infof("process completed for node %v: %v", lbclient.NodeName, report.Aliases)
 	} else {
-		log.Infof("node %v is registered on every alias it reported, lets proceed with the load update", lbclient.NodeName)
-		if status, err := lbclient.updateNode(); err != nil {
-			return messageToNode(status, fmt.Sprintf("error while updating load for node %v with error %v", lbclient.NodeName, err))
-		}
-	}
-	/*prepare to report for missing aliases in both sides*/
-	finalmsg := fmt.Sprintf("process completed for node %v", lbclient.NodeName)
-	//check for reported aliases, missing from db
-	missingfromdb := lbclient.missingfromdb()
-	if len(missingfromdb) != 0 {
-		finalmsg += fmt.Sprintf("##aliases not found in database: %v", missingfromdb)
+		log.Errorf("process failed for node %v: %v", lbclient.NodeName, report.Aliases)
 	}
-
-	//check for db aliases, missing from status report
-	notreported := lbclient.missingfromstatus()
-	if len(notreported) != 0 {
-		finalmsg += fmt.Sprintf("##aliases which did not receive an update: %v", notreported)
-
-	}
-
-	return messageToNode(http.StatusOK, finalmsg)
-
+	return c.JSON(status, report)
 }
+
 func messageToNode(status int, message string) error {
 
 	if 200 <= status && status < 300 {
@@ -3,28 +3,61 @@ package lbclient
 import (
 	"database/sql"
 	"fmt"
-	"net/http"
 	"time"
 
 	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
 	"gitlab.cern.ch/lb-experts/goermis/auth"
 	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
 )
 
+//SecretOf returns the secret shared with the nodes of an alias. Benchmarks replace it to run without tbag
+var SecretOf = auth.GetSecret
+
+//FreshSecretOf returns the secret of an alias without the cache, right after a promotion
+var FreshSecretOf = auth.GetFreshSecret
+
+//findAliases retrieves the reported aliases, together with the relations of the node in them
 func (lbclient *LBClient) findAliases() (err error) {
 	var (
 		reportedAliases []string
+		relations       []ermis.Relation
+		ids             []int
 	)
 	for _, v := range lbclient.Status {
 		reportedAliases = append(reportedAliases, v.AliasName)
 	}
 	//store the found aliases in lbclient struct
-	err = db.GetConn().Preload("Relations.Node").
+	err = db.GetConn().
 		Where("alias_name IN ?", reportedAliases).
 		Find(&lbclient.Aliases).Error
 	if err != nil {
 		return fmt.Errorf("error while retrieving the claimed aliases %v from node %v, with error %v", reportedAliases, lbclient.NodeName, err)
 	}
+	if len(lbclient.Aliases) == 0 {
+		return nil
+	}
+	for _, alias := range lbclient.Aliases {
+		ids = append(ids, alias.ID)
+	}
+	//a single query for the relations of the node in every reported alias
+	err = db.GetConn().Joins("Node").
+		Where("Node.node_name = ? AND alias_id IN ?", lbclient.NodeName, ids).
+		Find(&relations).Error
+	if err != nil {
+		return fmt.Errorf("error while retrieving the relations of node %v, with error %v", lbclient.NodeName, err)
+	}
+	lbclient.rotating, err = ermis.RotatingAliases(reportedAliases)
+	if err != nil {
+		return fmt.Errorf("error while retrieving the secret rotations of the claimed aliases, with error %v", err)
+	}
+	for i := range lbclient.Aliases {
+		for _, rel := range relations {
+			if rel.AliasID == lbclient.Aliases[i].ID {
+				lbclient.Aliases[i].Relations = append(lbclient.Aliases[i].Relations, rel)
+			}
+		}
+	}
 	return nil
 }
 
@@ -49,138 +82,172 @@ func (lbclient *LBClient) missingfromdb() []string {
 	return missingfromdb
 }
 
-func (lbclient *LBClient) missingfromstatus() []string {
-	var (
-		missingfromstatus []string
-	)
+//isRegistered returns true if the node is already related with the alias
+func (lbclient *LBClient) isRegistered(alias ermis.Alias) bool {
+	intf := ermis.Relation{
+		Node: &ermis.Node{
+			NodeName: lbclient.NodeName}}
+	ok, _ := ermis.Compare(intf, alias.Relations)
+	return ok
+}
 
-	for _, v1 := range lbclient.Aliases {
-		found := false
-		for _, v2 := range lbclient.Status {
-			if v1.AliasName == v2.AliasName {
-				found = true
-				break
-			}
-		}
-		// String not found. We add it to return slice
-		if !found {
-			missingfromstatus = append(missingfromstatus, v1.AliasName)
+func (lbclient *LBClient) findStatus(s string) (status Status) {
+	for _, v := range lbclient.Status {
+		if v.AliasName == s {
+			return v
 		}
 	}
-	return missingfromstatus
+	return Status{}
 }
 
-func (lbclient *LBClient) findUnregistered() (unregistered []string, err error) {
+/*process handles every reported alias independently. The unknown and unauthorized
+aliases are reported back, while the others are registered or updated in bulk*/
+func (lbclient *LBClient) process() []AliasOutcome {
 	var (
-		intf ermis.PrivilegeIntf
+		toRegister []ermis.Alias
+		toUpdate   []ermis.Alias
+		outcomes   = make(map[string]AliasOutcome)
 	)
-	//compare the relations of every alias we retrieved with the node name
-	for _, x := range lbclient.Aliases {
-		intf = ermis.Relation{
-			Node: &ermis.Node{
-				NodeName: lbclient.NodeName}}
-
-		if ok, _ := ermis.Compare(intf, x.Relations); !ok {
-			unregistered = append(unregistered, x.AliasName)
+	for _, name := range lbclient.missingfromdb() {
+		outcomes[name] = AliasOutcome{AliasName: name, Result: UnknownAlias, Message: "alias not found in database"}
+	}
+	for _, alias := range lbclient.Aliases {
+		status := lbclient.findStatus(alias.AliasName)
+		log.Infof("checking if node %v is authorized on alias %v", lbclient.NodeName, alias.AliasName)
+		if ok, reason := lbclient.authorized(alias, status); !ok {
+			log.Warnf("node %v is unauthorized on alias %v: %v", lbclient.NodeName, alias.AliasName, reason)
+			outcomes[alias.AliasName] = AliasOutcome{AliasName: alias.AliasName, Result: Unauthorized, Message: reason}
+			continue
+		}
+		if lbclient.isRegistered(alias) {
+			toUpdate = append(toUpdate, alias)
+		} else {
+			toRegister = append(toRegister, alias)
 		}
 	}
-	return unregistered, nil
-
-}
+	for _, o := range lbclient.registerNode(toRegister) {
+		outcomes[o.AliasName] = o
+	}
+	for _, o := range lbclient.updateNode(toUpdate) {
+		outcomes[o.AliasName] = o
+	}
+	if err := ermis.RecordLoads(lbclient.samples); err != nil {
+		log.Errorf("node %v: %v", lbclient.NodeName, err)
+	}
 
-func (lbclient *LBClient) findStatus(s string) (status Status) {
+	//reply in the order of the report
+	var ordered []AliasOutcome
 	for _, v := range lbclient.Status {
-		if v.AliasName == s {
-			return v
+		if o, found := outcomes[v.AliasName]; found {
+			ordered = append(ordered, o)
+			delete(outcomes, v.AliasName)
 		}
 	}
-	return Status{}
+	return ordered
 }
 
-func (lbclient *LBClient) registerNode(unreg []string) (int, error) {
-	log.Infof("started registration procedure for node %v in aliases %v", lbclient.NodeName, unreg)
-	for _, alias := range lbclient.Aliases {
-		if ermis.StringInSlice(alias.AliasName, unreg) {
-			status := lbclient.findStatus(alias.AliasName)
-
-			log.Infof("checking if node %v is authorized to register on alias %v", lbclient.NodeName, alias.AliasName)
-			if !checkLbclientAuth(status.AliasName, status.Secret) {
-				err := fmt.Errorf("unauthorized to register the load for node %v and alias %v, secret missmatch", lbclient.NodeName, status.AliasName)
-				return http.StatusUnauthorized, err
-			}
-
-			log.Infof("preparing the relation between node %v and alias %v", lbclient.NodeName, alias.AliasName)
-			relation := ermis.Relation{
-				AliasID:   alias.ID,
-				NodeID:    0,
-				Blacklist: false,
-				Node: &ermis.Node{
-					ID:       0,
-					NodeName: lbclient.NodeName,
-					LastModification: sql.NullTime{
-						Time:  time.Now(),
-						Valid: true,
-					},
-				},
-				Load: status.Load,
-				LastLoadUpdate: sql.NullTime{
-					Time:  time.Now(),
-					Valid: true,
-				},
-			}
-
-			log.Infof("ready to create the relation for node %v and alias %v", lbclient.NodeName, alias.AliasName)
-			err := ermis.AddNodeTransactions(relation)
-			if err != nil {
-				return http.StatusBadRequest, err
-			} else {
-				log.Infof("successful registration for node %v on alias %v", lbclient.NodeName, alias.AliasName)
-			}
-
+//outcomesOf gives the same result to every alias
+func outcomesOf(aliases []ermis.Alias, result string, err error) (outcomes []AliasOutcome) {
+	for _, alias := range aliases {
+		o := AliasOutcome{AliasName: alias.AliasName, Result: result}
+		if err != nil {
+			o.Message = err.Error()
 		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes
+}
 
+//registerNode creates the relations of the node with the unregistered aliases in a single transaction
+func (lbclient *LBClient) registerNode(aliases []ermis.Alias) []AliasOutcome {
+	var relations []ermis.Relation
+	if len(aliases) == 0 {
+		return nil
+	}
+	log.Infof("started registration procedure for node %v in %d aliases", lbclient.NodeName, len(aliases))
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	for _, alias := range aliases {
+		relations = append(relations, ermis.Relation{
+			AliasID:        alias.ID,
+			Blacklist:      false,
+			Load:           lbclient.findStatus(alias.AliasName).Load,
+			LastLoadUpdate: now,
+		})
+	}
+	node := ermis.Node{NodeName: lbclient.NodeName, LastModification: now}
+	if err := ermis.AddNodeInAliasesTransactions(node, relations); err != nil {
+		log.Errorf("error while registering node %v, error: %v", lbclient.NodeName, err)
+		return outcomesOf(aliases, Failed, err)
 	}
+	//the relations got the id of the node in the transaction
+	lbclient.addSamples(relations, now.Time)
 	log.Infof("successful registration for node %v with the latest load value. exiting node registration...", lbclient.NodeName)
-	return http.StatusCreated, nil
+	return outcomesOf(aliases, Registered, nil)
 }
 
-func (lbclient LBClient) updateNode() (int, error) {
-	log.Infof("started update procedure for node %v in every alias", lbclient.NodeName)
-	for _, alias := range lbclient.Aliases {
-
-		status := lbclient.findStatus(alias.AliasName)
-
-		log.Infof("checking if node %v is authorized to update alias %v", lbclient.NodeName, alias.AliasName)
-		if !checkLbclientAuth(status.AliasName, status.Secret) {
-			err := fmt.Errorf("unauthorized to update the load for node %v and alias %v, secret missmatch", lbclient.NodeName, status.AliasName)
-			return http.StatusUnauthorized, err
-		}
-		log.Infof("preparing to update the load for node %v and alias %v", lbclient.NodeName, alias.AliasName)
+/*updateNode applies the load of every registered alias in a single statement.
+The load of every alias is picked by a CASE on the alias id*/
+func (lbclient *LBClient) updateNode(aliases []ermis.Alias) []AliasOutcome {
+	var (
+		ids    []int
+		nodeID int
+		args   []interface{}
+	)
+	if len(aliases) == 0 {
+		return nil
+	}
+	log.Infof("started update procedure for node %v in %d aliases", lbclient.NodeName, len(aliases))
+	cases := "CASE alias_id"
+	for _, alias := range aliases {
 		for _, rel := range alias.Relations {
-			if rel.Node.NodeName == lbclient.NodeName {
-				err := db.GetConn().Select("load", "last_check").
-					Where("alias_id=? AND node_id=?", alias.ID, rel.NodeID).Updates(
-					ermis.Relation{
-						Load: status.Load,
-						LastLoadUpdate: sql.NullTime{
-							Time:  time.Now(),
-							Valid: true,
-						}}).Error
-				if err != nil {
-					return http.StatusBadRequest, err
-				}
-				log.Infof("updated node %v on alias %v with new load value %v", lbclient.NodeName, status.AliasName, status.Load)
+			if rel.Node != nil && rel.Node.NodeName == lbclient.NodeName {
+				nodeID = rel.NodeID
+				ids = append(ids, alias.ID)
+				cases += " WHEN ? THEN ?"
+				args = append(args, alias.ID, lbclient.findStatus(alias.AliasName).Load)
 			}
-
 		}
+	}
+	cases += " ELSE `load` END"
+	now := time.Now()
+
+	err := db.GetConn().Model(&ermis.Relation{}).
+		Where("node_id = ? AND alias_id IN ?", nodeID, ids).
+		Updates(map[string]interface{}{
+			"load":             gorm.Expr(cases, args...),
+			"last_load_update": now,
+		}).Error
+	if err != nil {
+		log.Errorf("error while updating load for node %v with error %v", lbclient.NodeName, err)
+		return outcomesOf(aliases, Failed, err)
+	}
+	var updated []ermis.Relation
+	for _, id := range ids {
+		updated = append(updated, ermis.Relation{AliasID: id, NodeID: nodeID})
+	}
+	lbclient.addSamples(updated, now)
+	log.Infof("successful load update for node %v in %d aliases. exiting load update...", lbclient.NodeName, len(ids))
+	return outcomesOf(aliases, Updated, nil)
+}
 
+//addSamples keeps the loads reported for the relations, for the load history
+func (lbclient *LBClient) addSamples(relations []ermis.Relation, now time.Time) {
+	for _, r := range relations {
+		lbclient.samples = append(lbclient.samples, ermis.LoadSample{
+			AliasID: r.AliasID,
+			NodeID:  r.NodeID,
+			Time:    now,
+			Load:    lbclient.loadOf(r.AliasID),
+		})
 	}
-	log.Infof("successful load update for node %v. exiting load update...", lbclient.NodeName)
-	return http.StatusOK, nil
 }
 
-func checkLbclientAuth(aliasname, secret string) bool {
-	log.Info(secret)
-	log.Info(auth.GetSecret(aliasname))
-	return secret == auth.GetSecret(aliasname)
+//loadOf returns the load reported for the alias with the given id
+func (lbclient *LBClient) loadOf(aliasID int) int {
+	for _, alias := range lbclient.Aliases {
+		if alias.ID == aliasID {
+			return lbclient.findStatus(alias.AliasName).Load
+		}
+	}
+	return 0
 }
@@ -0,0 +1,165 @@
+package lbclient
+
+/*This file contains the authentication of the signed reports. The node sends
+the unix time in the X-Ermis-Timestamp header and, for every alias, the HMAC-SHA256
+of "<timestamp>.<body>" with the secret of the alias in the X-Ermis-Signature header:
+	X-Ermis-Signature: alias1.cern.ch=<hex>, alias2.cern.ch=<hex>
+The reports older than the signature window are refused. The verified signatures are
+recorded in the DB until they leave the window, so that a report replayed to any replica
+is refused as well.
+The aliases without a signature may still authenticate with the plain secret in the body,
+unless the legacy authentication is disabled for them*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm/clause"
+)
+
+//The headers of the signed reports
+const (
+	TimestampHeader = "X-Ermis-Timestamp"
+	SignatureHeader = "X-Ermis-Signature"
+)
+
+//SeenSignature is a verified signature of a fresh report, shared by the replicas to refuse the replays
+type SeenSignature struct {
+	Signature string    `  gorm:"type:varchar(64);primaryKey"`
+	Expiry    time.Time `  gorm:"type:datetime;not null;index"`
+}
+
+var signatureWindow = window(bootstrap.GetConf().LBClient.SignatureWindow)
+
+//window returns the configured freshness of the signed reports, 5 minutes by default
+func window(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+//Sign returns the signature of a report for an alias, as the nodes compute it
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//parseSignatures splits the signature header into the signature of every alias
+func parseSignatures(header string) map[string]string {
+	signatures := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			signatures[kv[0]] = kv[1]
+		}
+	}
+	return signatures
+}
+
+//checkFreshness refuses the reports whose timestamp is out of the window around the current time
+func checkFreshness(timestamp string, now time.Time) error {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed timestamp")
+	}
+	sent := time.Unix(unix, 0)
+	if now.Sub(sent) > signatureWindow || sent.Sub(now) > signatureWindow {
+		return fmt.Errorf("the timestamp is out of the window of %v", signatureWindow)
+	}
+	return nil
+}
+
+/*recordSignature stores a verified signature until its report leaves the window.
+The signature is the key of the table, so an insert that does nothing is a replay.
+If the DB cannot tell, the report is refused*/
+func recordSignature(signature, timestamp string) error {
+	unix, _ := strconv.ParseInt(timestamp, 10, 64)
+	result := db.GetConn().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&SeenSignature{Signature: signature, Expiry: time.Unix(unix, 0).Add(signatureWindow)})
+	if result.Error != nil {
+		log.Errorf("could not record the signature of a report: %v", result.Error)
+		return fmt.Errorf("could not check if the report was already received")
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("the report was already received")
+	}
+	return nil
+}
+
+//PurgeSignatures deletes the signatures of the reports out of the window, they cannot be replayed anymore
+func PurgeSignatures() error {
+	if err := db.GetConn().Where("expiry < ?", time.Now()).Delete(&SeenSignature{}).Error; err != nil {
+		return fmt.Errorf("failed to delete the expired signatures: %v", err)
+	}
+	return nil
+}
+
+/*authorized checks the signature of the alias, or its plain secret when the
+report is not signed for it and the alias accepts the legacy authentication.
+The secrets are never logged*/
+func (lbclient *LBClient) authorized(alias ermis.Alias, status Status) (bool, string) {
+	secrets := lbclient.secretsOf(alias.AliasName)
+	if signature, found := lbclient.signatures[alias.AliasName]; found {
+		if lbclient.freshness != nil {
+			return false, lbclient.freshness.Error()
+		}
+		for _, secret := range secrets {
+			expected := Sign(secret, lbclient.timestamp, lbclient.body)
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				//only the verified signatures are recorded, the others cannot fill the table
+				if err := recordSignature(signature, lbclient.timestamp); err != nil {
+					return false, err.Error()
+				}
+				return true, ""
+			}
+		}
+		return false, "signature missmatch"
+	}
+	if !alias.LegacyAuth {
+		return false, "the report must be signed for this alias"
+	}
+	for _, secret := range secrets {
+		if subtle.ConstantTimeCompare([]byte(status.Secret), []byte(secret)) == 1 {
+			return true, ""
+		}
+	}
+	return false, "secret missmatch"
+}
+
+//secretsOf returns the accepted secrets of an alias reported in the request
+func (lbclient *LBClient) secretsOf(aliasname string) []string {
+	return AcceptedSecrets(aliasname, lbclient.rotating[aliasname])
+}
+
+/*AcceptedSecrets returns the accepted secrets of an alias in a rotation state: the current one,
+plus the next one while rotating. For a cache TTL after the promotion, the cache of this replica
+may still have the previous secret, so the current one is also read from tbag*/
+func AcceptedSecrets(aliasname, state string) (secrets []string) {
+	candidates := []string{SecretOf(aliasname)}
+	switch state {
+	case ermis.RotationRotating:
+		candidates = append(candidates, SecretOf(ermis.NextSecretName(aliasname)))
+	case ermis.RotationPromoted:
+		if fresh := FreshSecretOf(aliasname); fresh != candidates[0] {
+			candidates = append(candidates, fresh)
+		}
+	}
+	for _, secret := range candidates {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
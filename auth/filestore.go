@@ -0,0 +1,155 @@
+package auth
+
+/*This file contains the encrypted file backend of the secrets. The secrets
+are encrypted one by one with AES-GCM and the key of the config, then kept
+in a JSON file. Every change rewrites the file atomically*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//fileStore keeps the encrypted secrets in a local file
+type fileStore struct {
+	sync.Mutex
+	path string
+	aead cipher.AEAD
+	err  error
+}
+
+//newFileStore prepares the store of the file. The key is the base64 of 32 random bytes
+func newFileStore(path, key string) *fileStore {
+	s := &fileStore{path: path}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		s.err = fmt.Errorf("the key of the secrets file must be the base64 of 32 bytes")
+		return s
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		s.err = err
+	}
+	if path == "" {
+		s.err = fmt.Errorf("no file configured for the secrets")
+	}
+	return s
+}
+
+//NewFileStore returns an encrypted file store, e.g. for the tests
+func NewFileStore(path, key string) (SecretStore, error) {
+	s := newFileStore(path, key)
+	return s, s.err
+}
+
+//load reads the encrypted secrets of the file, none if it does not exist yet
+func (s *fileStore) load() (map[string]string, error) {
+	secrets := make(map[string]string)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("malformed secrets file %v: %v", s.path, err)
+	}
+	return secrets, nil
+}
+
+//save writes the secrets to a temporary file and moves it in place
+func (s *fileStore) save(secrets map[string]string) error {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".secrets")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+//Get decrypts the secret of an alias
+func (s *fileStore) Get(aliasname string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.Lock()
+	defer s.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	encrypted, found := secrets[aliasname]
+	if !found {
+		return "", nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return "", fmt.Errorf("malformed secret of %v", aliasname)
+	}
+	nonce, ciphertext := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	//the alias is authenticated, so a secret cannot be moved to another alias
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(aliasname))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt the secret of %v", aliasname)
+	}
+	return string(plain), nil
+}
+
+//Put encrypts and stores the secret of an alias
+func (s *fileStore) Put(aliasname, secret string) error {
+	if s.err != nil {
+		return s.err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), []byte(aliasname))
+
+	s.Lock()
+	defer s.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[aliasname] = base64.StdEncoding.EncodeToString(sealed)
+	return s.save(secrets)
+}
+
+//Delete removes the secret of an alias
+func (s *fileStore) Delete(aliasname string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.Lock()
+	defer s.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(secrets, aliasname)
+	return s.save(secrets)
+}
@@ -0,0 +1,145 @@
+package auth
+
+/*This file contains the storage of the alias secrets shared with the lbclients.
+The backend is chosen in the config: tbag by default, or an encrypted local file
+for the test and development deployments. A cache with a time to live sits in
+front of the backend, so the lbclient reports don't query it every time*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	//SecretStore keeps the secrets of the aliases
+	SecretStore interface {
+		//Get returns the secret of an alias, empty if it has none
+		Get(aliasname string) (string, error)
+		Put(aliasname, secret string) error
+		Delete(aliasname string) error
+	}
+	//cachedStore keeps the secrets read from the backend for a while
+	cachedStore struct {
+		sync.Mutex
+		backend SecretStore
+		ttl     time.Duration
+		entries map[string]cachedSecret
+	}
+	cachedSecret struct {
+		secret  string
+		expires time.Time
+	}
+)
+
+var store = newStore()
+
+//newStore builds the store of the config
+func newStore() SecretStore {
+	var backend SecretStore
+	switch cfg.Secrets.Backend {
+	case "", "tbag":
+		backend = tbagStore{}
+	case "file":
+		backend = newFileStore(cfg.Secrets.File, cfg.Secrets.Key)
+	default:
+		log.Errorf("unknown secrets backend %v, using tbag", cfg.Secrets.Backend)
+		backend = tbagStore{}
+	}
+	return NewCachedStore(backend, CacheTTL())
+}
+
+//CacheTTL returns how long the secrets are cached, 5 minutes by default
+func CacheTTL() time.Duration {
+	if cfg.Secrets.CacheTTL <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(cfg.Secrets.CacheTTL) * time.Second
+}
+
+//SetStore replaces the store of the secrets, e.g. for the tests and benchmarks
+func SetStore(s SecretStore) {
+	store = s
+}
+
+//NewCachedStore puts a thread-safe cache with the given time to live in front of a store
+func NewCachedStore(backend SecretStore, ttl time.Duration) SecretStore {
+	return &cachedStore{backend: backend, ttl: ttl, entries: make(map[string]cachedSecret)}
+}
+
+//Get returns the cached secret, or reads it from the backend. The missing secrets are not cached
+func (c *cachedStore) Get(aliasname string) (string, error) {
+	c.Lock()
+	entry, found := c.entries[aliasname]
+	c.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.secret, nil
+	}
+	secret, err := c.backend.Get(aliasname)
+	if err != nil || secret == "" {
+		return secret, err
+	}
+	c.Lock()
+	c.entries[aliasname] = cachedSecret{secret: secret, expires: time.Now().Add(c.ttl)}
+	c.Unlock()
+	return secret, nil
+}
+
+//Put stores the secret in the backend and forgets the cached one
+func (c *cachedStore) Put(aliasname, secret string) error {
+	c.forget(aliasname)
+	return c.backend.Put(aliasname, secret)
+}
+
+//Delete removes the secret from the backend and the cache
+func (c *cachedStore) Delete(aliasname string) error {
+	c.forget(aliasname)
+	return c.backend.Delete(aliasname)
+}
+
+func (c *cachedStore) forget(aliasname string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, aliasname)
+}
+
+//GetSecret returns the secret of an alias, empty if it has none or the store failed
+func GetSecret(aliasname string) string {
+	secret, err := store.Get(aliasname)
+	if err != nil {
+		log.Errorf("failed to retrieve the secret of %v: %v", aliasname, err)
+		return ""
+	}
+	return secret
+}
+
+//GetFreshSecret returns the secret of an alias from the backend, bypassing the cache and leaving it untouched.
+//The other replicas may still cache a secret that was replaced, so this is how the new one is found
+func GetFreshSecret(aliasname string) string {
+	s := store
+	if c, ok := store.(*cachedStore); ok {
+		s = c.backend
+	}
+	secret, err := s.Get(aliasname)
+	if err != nil {
+		log.Errorf("failed to retrieve the secret of %v: %v", aliasname, err)
+		return ""
+	}
+	return secret
+}
+
+//PostSecret stores the secret of an alias
+func PostSecret(aliasname, secret string) error {
+	if err := store.Put(aliasname, secret); err != nil {
+		return fmt.Errorf("failed to store the secret of %v: %v", aliasname, err)
+	}
+	return nil
+}
+
+//DeleteSecret removes the secret of an alias
+func DeleteSecret(aliasname string) error {
+	if err := store.Delete(aliasname); err != nil {
+		return fmt.Errorf("failed to delete the secret of %v: %v", aliasname, err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -45,21 +46,44 @@ CERN.CH  = {
 `
 )
 
-var secretsCache = make(map[string]string)
+//tbagStore keeps the secrets in tbag. It reads them through SSL and modifies them through kerberos
+type tbagStore struct{}
 
-//GetSecret queries tbag for the secret of an alias
-func (l *UserAuth) get(aliasname string) string {
+//Get queries tbag for the secret of an alias
+func (tbagStore) Get(aliasname string) (string, error) {
+	conn := getConn(cfg.Teigi.Ssltbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
+	if conn == nil {
+		return "", fmt.Errorf("no connection to tbag")
+	}
+	return conn.get(aliasname)
+}
+
+//Put stores the secret of an alias in tbag
+func (tbagStore) Put(aliasname, secret string) error {
+	conn := getConn(cfg.Teigi.Krbtbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
+	if conn == nil {
+		return fmt.Errorf("no connection to tbag")
+	}
+	return conn.modify("POST", aliasname, secret)
+}
+
+//Delete removes the secret of an alias from tbag
+func (tbagStore) Delete(aliasname string) error {
+	conn := getConn(cfg.Teigi.Krbtbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
+	if conn == nil {
+		return fmt.Errorf("no connection to tbag")
+	}
+	return conn.modify("DELETE", aliasname, "")
+}
+
+//get queries tbag for the secret of an alias
+func (l *UserAuth) get(aliasname string) (string, error) {
 	type msg struct {
 		Secret string
 	}
 	var (
 		message msg
 	)
-
-	//check local cache first
-	if v, found := secretsCache[aliasname]; found && len(v) != 0 {
-		return secretsCache[aliasname]
-	}
 	//find hostname of node
 	hostname, _ := os.Hostname()
 
@@ -68,8 +92,7 @@ func (l *UserAuth) get(aliasname string) string {
 	log.Info("Querying tbag for the secret of alias" + aliasname + ". URL = " + URL)
 	req, err := http.NewRequest("GET", URL, nil)
 	if err != nil {
-		log.Errorf("Error on creating request object. %v ", err)
-		return ""
+		return "", fmt.Errorf("error on creating request object. %v ", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -77,34 +100,27 @@ func (l *UserAuth) get(aliasname string) string {
 
 	resp, err := l.Client.Do(req)
 	if err != nil {
-		log.Errorf("Error on dispatching secret request to tbag for node  %v , error %v", aliasname, err)
-		return ""
+		return "", fmt.Errorf("error on dispatching secret request to tbag for alias %v , error %v", aliasname, err)
 	}
+	defer resp.Body.Close()
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("Error reading Body of Request while querying the secret of node %v , error: %v ", aliasname, err)
-		return ""
+		return "", fmt.Errorf("error reading Body of Request while querying the secret of alias %v , error: %v ", aliasname, err)
 	}
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		log.Errorf("User not authorized.Status Code:%v ", resp.StatusCode)
-		return ""
+		return "", fmt.Errorf("user not authorized.Status Code:%v ", resp.StatusCode)
 	}
 
 	if err = json.Unmarshal(data, &message); err != nil {
-		log.Errorf("Error on unmarshalling response from tbag %v", err)
-		return ""
+		return "", fmt.Errorf("error on unmarshalling response from tbag %v", err)
 	}
-	defer resp.Body.Close()
-	//save locally
-	secretsCache[aliasname] = message.Secret
-
-	return message.Secret
+	return message.Secret, nil
 
 }
 
-//
+//modify creates or deletes the secret of an alias, authenticating with kerberos
 func (l *UserAuth) modify(method, aliasname, secret string) error {
 
 	buffer := &bytes.Buffer{}
@@ -115,7 +131,7 @@ func (l *UserAuth) modify(method, aliasname, secret string) error {
 		secret := map[string]string{"secret": secret}
 		json_secret, err := json.Marshal(secret)
 		if err != nil {
-			log.Error(err)
+			return err
 		}
 		buffer.Write(json_secret)
 
@@ -127,31 +143,37 @@ func (l *UserAuth) modify(method, aliasname, secret string) error {
 	//prepare request
 	r, err := http.NewRequest(method, URL, buffer)
 	if err != nil {
-		log.Errorf("could not create request: %v", err)
+		return fmt.Errorf("could not create request: %v", err)
 	}
 
-	// Load the client krb5 config
-	conf, err := config.NewFromString(kRB5CONF)
+	// Load the client krb5 config, the one of the CERN realm by default
+	var conf *config.Config
+	if cfg.Teigi.Krb5Conf != "" {
+		conf, err = config.Load(cfg.Teigi.Krb5Conf)
+	} else {
+		conf, err = config.NewFromString(kRB5CONF)
+	}
 	if err != nil {
-		log.Errorf("could not load krb5.conf: %v", err)
+		return fmt.Errorf("could not load krb5.conf: %v", err)
+	}
+	realm := cfg.Teigi.Realm
+	if realm == "" {
+		realm = "CERN.CH"
 	}
 
 	// Create the client with ccache
 	cl := client.NewWithPassword(
 		cfg.Teigi.User,
-		"CERN.CH",
+		realm,
 		string(decodedPass),
 		conf,
 		client.DisablePAFXFAST(true),
 	)
-	if err != nil {
-		log.Errorf("could not create client: %v", err)
-	}
 
 	// Log in the client
 	err = cl.Login()
 	if err != nil {
-		log.Errorf("could not login client: %v", err)
+		return fmt.Errorf("could not login client: %v", err)
 	}
 
 	spnegoCl := spnego.NewClient(cl, nil, "")
@@ -159,32 +181,15 @@ func (l *UserAuth) modify(method, aliasname, secret string) error {
 	// Make the request
 	resp, err := spnegoCl.Do(r)
 	if err != nil {
-		log.Errorf("error making request: %v", err)
+		return fmt.Errorf("error making request: %v", err)
 	}
+	defer resp.Body.Close()
 	_, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Errorf("error reading response body: %v", err)
+		return fmt.Errorf("error reading response body: %v", err)
 	}
-	return nil
-}
-
-func PostSecret(aliasname, secret string) error {
-	conn := getConn(cfg.Teigi.Krbtbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
-	return conn.modify("POST", aliasname, secret)
-}
-
-func GetSecret(aliasname string) string {
-	conn := getConn(cfg.Teigi.Ssltbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
-	return conn.get(aliasname)
-}
-
-func DeleteSecret(aliasname string) error {
-	conn := getConn(cfg.Teigi.Krbtbag, cfg.Certs.HostCert, cfg.Certs.HostKey)
-	//delete from local secret cache (basically a map)
-	_, ok := secretsCache[aliasname]
-	if ok {
-		delete(secretsCache, aliasname)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("tbag replied with status %v", resp.Status)
 	}
-	//send a delete request to tbag
-	return conn.modify("DELETE", aliasname, "")
+	return nil
 }
@@ -13,14 +13,25 @@ import (
 type (
 	//Config describes the yaml file
 	Config struct {
-		App      App
-		Database Database
-		Soap     Soap
-		Certs    Certs
-		Log      Logging
-		DNS      DNS
-		Timers   Timers
-		Teigi    Teigi
+		App            App
+		Database       Database
+		Soap           Soap
+		Certs          Certs
+		Log            Logging
+		DNS            DNS
+		Timers         Timers
+		Teigi          Teigi
+		Reconciler     Reconciler
+		Notifications  Notifications
+		AlarmPolicy    AlarmPolicy    `yaml:"alarm_policy"`
+		AlarmChecks    AlarmChecks    `yaml:"alarm_checks"`
+		LeaderElection LeaderElection `yaml:"leader_election"`
+		Scheduler      Scheduler
+		LBClient       LBClient `yaml:"lbclient"`
+		Secrets        Secrets
+		StaleNodes     StaleNodes  `yaml:"stale_nodes"`
+		LoadHistory    LoadHistory `yaml:"load_history"`
+		LBD            LBD         `yaml:"lbd"`
 	}
 	//App struct describes application config parameters
 	App struct {
@@ -71,6 +82,94 @@ type (
 	Timers struct {
 		Alarms int
 	}
+	//Reconciler describes the optional convergence of the aliases to a directory of spec files
+	Reconciler struct {
+		Enabled   bool
+		Directory string
+		Interval  int
+		Prune     bool
+	}
+	//Notifications describes the channels used to deliver the alarm notifications
+	Notifications struct {
+		SMTP         SMTP
+		Webhooks     map[string]Webhook
+		Mattermost   map[string]Webhook
+		Templates    Templates
+		DigestWindow int `yaml:"digest_window"`
+	}
+	//SMTP describes the mail server used for the mailto recipients
+	SMTP struct {
+		Host     string
+		Port     int
+		TLS      bool
+		Username string
+		Password string
+		Sender   string
+	}
+	//Webhook describes a named endpoint that receives the notifications
+	Webhook struct {
+		URL string
+	}
+	//Templates describes the text/template of the notification messages
+	Templates struct {
+		Subject string
+		Body    string
+	}
+	//AlarmPolicy describes when the alarms fire, resolve and notify again
+	AlarmPolicy struct {
+		FireAfter    int `yaml:"fire_after"`
+		ResolveAfter int `yaml:"resolve_after"`
+		Renotify     int
+		SkipResolved bool `yaml:"skip_resolved"`
+	}
+	//AlarmChecks describes how the periodic evaluation of the alarms is carried out
+	AlarmChecks struct {
+		Workers        int
+		Timeout        int
+		Resolvers      []string
+		AdminRecipient string `yaml:"admin_recipient"`
+	}
+	//LeaderElection describes the lease that selects the replica running the periodic jobs
+	LeaderElection struct {
+		Lease int
+	}
+	//Scheduler overrides the schedule of the periodic jobs by name
+	Scheduler struct {
+		Jobs map[string]JobSchedule
+	}
+	//JobSchedule describes when a job runs, either on an interval or a cron expression
+	JobSchedule struct {
+		Interval int
+		Cron     string
+		Jitter   int
+	}
+	//LBClient describes the authentication of the lbclient reports
+	LBClient struct {
+		SignatureWindow int `yaml:"signature_window"`
+	}
+	//Secrets describes the handling of the alias secrets shared with the lbclients
+	Secrets struct {
+		RotationGrace int    `yaml:"rotation_grace"`
+		Backend       string //tbag or file
+		File          string
+		Key           string
+		CacheTTL      int `yaml:"cache_ttl"`
+	}
+	//StaleNodes describes the handling of the nodes that stopped reporting their load
+	StaleNodes struct {
+		Period        int
+		AutoBlacklist bool `yaml:"auto_blacklist"`
+	}
+	//LoadHistory describes how long the load reports of the nodes are kept
+	LoadHistory struct {
+		Raw        int //hours
+		Resolution int //minutes
+		Retention  int //days
+	}
+	//LBD describes the generations kept of the configuration exported to the load balancing daemon
+	LBD struct {
+		Snapshots int
+	}
 	//The host which has access to tbag for saving the secrets
 	Teigi struct {
 		User     string
@@ -80,6 +179,8 @@ type (
 		Ssltbag  string
 		Krbtbag  string
 		Pwn      string
+		Realm    string
+		Krb5Conf string `yaml:"krb5_conf"`
 	}
 )
 
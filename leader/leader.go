@@ -0,0 +1,165 @@
+package leader
+
+/*This file contains the election of the replica that runs the periodic jobs.
+The replicas compete for a lease, a row of the DB with its holder and expiry.
+The holder renews it before it expires. If the holder dies, the lease expires
+and another replica takes it over on its next attempt*/
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gorm.io/gorm"
+)
+
+const leaseName = "periodic_jobs"
+
+type (
+	//Lease is held by the replica that runs the periodic jobs until it expires
+	Lease struct {
+		Name   string    `  gorm:"type:varchar(40);primaryKey"`
+		Holder string    `  gorm:"type:varchar(255);not null"`
+		Expiry time.Time `  gorm:"type:datetime;not null"`
+	}
+	//Status describes the current holder of the lease, as seen by this replica
+	Status struct {
+		Identity string     `json:"identity"`
+		Leader   bool       `json:"leader"`
+		Holder   string     `json:"holder"`
+		Expiry   *time.Time `json:"expiry,omitempty"`
+		Error    string     `json:"error,omitempty"`
+	}
+)
+
+var (
+	log      = bootstrap.GetLog()
+	duration = leaseDuration(bootstrap.GetConf().LeaderElection.Lease)
+	identity = newIdentity()
+	mu       sync.RWMutex
+	leading  bool
+	deadline time.Time
+)
+
+//leaseDuration returns the configured duration of the lease, 30 seconds by default
+func leaseDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+//newIdentity names this replica after its host(the pod name) and process
+func newIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+//Run competes for the lease in the background, renewing it three times per lease duration
+func Run() {
+	go func() {
+		for {
+			if err := tryAcquire(); err != nil {
+				log.Errorf("Could not acquire the lease %v: %v", leaseName, err)
+			}
+			time.Sleep(duration / 3)
+		}
+	}()
+}
+
+/*tryAcquire competes for the lease on behalf of this replica. The leadership is trusted
+locally for the lease duration minus a margin, counted from before the attempt on the
+monotonic clock, so that it ends before any other replica can take the lease over*/
+func tryAcquire() error {
+	start := time.Now()
+	acquired, err := Acquire(identity)
+	setLeading(acquired, start.Add(duration-duration/6))
+	return err
+}
+
+/*
+Acquire takes the lease for holder if it is free or expired, and renews it if holder has it.
+The update is conditional, so only one of the replicas succeeds. The expiry is computed and
+compared by the DB, the clocks of the replicas may differ
+*/
+func Acquire(holder string) (bool, error) {
+	until := gorm.Expr("NOW() + INTERVAL ? SECOND", int(duration/time.Second))
+	result := db.GetConn().Model(&Lease{}).
+		Where("name = ? AND (holder = ? OR expiry < NOW())", leaseName, holder).
+		Updates(map[string]interface{}{"holder": holder, "expiry": until})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		//Either another replica holds it, or the lease does not exist yet
+		err := db.GetConn().Model(&Lease{}).
+			Create(map[string]interface{}{"name": leaseName, "holder": holder, "expiry": until}).Error
+		return err == nil, nil
+	}
+	return true, nil
+}
+
+//setLeading keeps the outcome of the last attempt, logging the changes of leadership
+func setLeading(leader bool, until time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	if leader != leading {
+		if leader {
+			log.Infof("%v is now the leader and runs the periodic jobs", identity)
+		} else {
+			log.Infof("%v is not the leader anymore", identity)
+		}
+	}
+	leading = leader
+	deadline = until
+}
+
+//IsLeader returns true if this replica holds the lease and its local deadline has not passed yet
+func IsLeader() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return leading && time.Now().Before(deadline)
+}
+
+//Release gives up the lease, so that another replica takes over without waiting for the expiry
+func Release() {
+	if !IsLeader() {
+		return
+	}
+	if err := db.GetConn().Model(&Lease{}).
+		Where("name = ? AND holder = ?", leaseName, identity).
+		Update("expiry", gorm.Expr("NOW()")).Error; err != nil {
+		log.Errorf("Could not release the lease %v: %v", leaseName, err)
+	}
+	setLeading(false, time.Time{})
+}
+
+//Holder returns the replica holding the lease, empty if nobody holds it
+func Holder() (string, error) {
+	var lease Lease
+	if err := db.GetConn().Where("name = ? AND expiry > NOW()", leaseName).Limit(1).Find(&lease).Error; err != nil {
+		return "", err
+	}
+	return lease.Holder, nil
+}
+
+//GetStatus returns the current leader of the periodic jobs
+func GetStatus(c echo.Context) error {
+	var lease Lease
+	status := Status{Identity: identity, Leader: IsLeader()}
+	if err := db.GetConn().Where("name = ?", leaseName).Limit(1).Find(&lease).Error; err != nil {
+		status.Error = err.Error()
+	} else if lease.Name != "" {
+		status.Holder = lease.Holder
+		status.Expiry = &lease.Expiry
+	}
+	return c.JSON(http.StatusOK, status)
+}
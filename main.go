@@ -9,9 +9,12 @@ import (
 
 	"gitlab.cern.ch/lb-experts/goermis/alarms"
 	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/api/lbclient"
 	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
 	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gitlab.cern.ch/lb-experts/goermis/leader"
 	"gitlab.cern.ch/lb-experts/goermis/router"
+	"gitlab.cern.ch/lb-experts/goermis/scheduler"
 	"gitlab.cern.ch/lb-experts/goermis/views"
 )
 
@@ -44,26 +47,82 @@ func main() {
 	views.InitViews(echo)
 	autoMigrateTables()
 
-	//Alarms periodic check/update
-
-	ticker := time.NewTicker(time.Duration(cfg.Timers.Alarms) * time.Minute)
-
-	/*done channel can be used to stop the ticker if needed,
-	by issuing the command "done<-true". For now, it runs constantly */
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case <-done:
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				log.Debugf("%v minutes passed, preparing to check for active alarms", cfg.Timers.Alarms)
-				alarms.PeriodicAlarmCheck()
-			}
+	//Only the replica holding the lease runs the periodic jobs
+	leader.Run()
+	defer leader.Release()
+
+	//Periodic jobs
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "alarms",
+		Interval:   time.Duration(cfg.Timers.Alarms) * time.Minute,
+		LeaderOnly: true,
+		Run: func() error {
+			alarms.PeriodicAlarmCheck()
+			return nil
+		},
+	}); err != nil {
+		log.Error(err)
+	}
+	//Optional convergence of the aliases to the spec files directory
+	if cfg.Reconciler.Enabled {
+		if err := scheduler.Register(scheduler.Job{
+			Name:       "reconciler",
+			Interval:   time.Duration(cfg.Reconciler.Interval) * time.Minute,
+			LeaderOnly: true,
+			Run: func() error {
+				ermis.Reconcile()
+				return nil
+			},
+		}); err != nil {
+			log.Error(err)
 		}
-	}()
-	log.Debug("alarms updated")
+	}
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "secret_rotation",
+		Interval:   5 * time.Minute,
+		LeaderOnly: true,
+		Run:        ermis.PromoteSecrets,
+	}); err != nil {
+		log.Error(err)
+	}
+	//Flags, and optionally blacklists, the nodes that stopped reporting their load
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "stale_nodes",
+		Interval:   5 * time.Minute,
+		LeaderOnly: true,
+		Run:        alarms.CheckStaleNodes,
+	}); err != nil {
+		log.Error(err)
+	}
+	//Averages and expires the load history of the nodes
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "load_history",
+		Interval:   time.Hour,
+		LeaderOnly: true,
+		Run:        ermis.CompactLoadHistory,
+	}); err != nil {
+		log.Error(err)
+	}
+	//Keeps a generation of the lbd configuration whenever it changes
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "lbd_config",
+		Interval:   time.Minute,
+		LeaderOnly: true,
+		Run:        ermis.SnapshotLBDConfig,
+	}); err != nil {
+		log.Error(err)
+	}
+	//Forgets the signatures of the lbclient reports that left the window
+	if err := scheduler.Register(scheduler.Job{
+		Name:       "signatures",
+		Interval:   10 * time.Minute,
+		LeaderOnly: true,
+		Run:        lbclient.PurgeSignatures,
+	}); err != nil {
+		log.Error(err)
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
 
 	/* Start server
 	       Error handling is done a bit differently in this situation. The reason is that
@@ -101,6 +160,6 @@ func main() {
 
 // autoMigrateTables: migrate table columns using GORM. Will not delete/change types for security reasons
 func autoMigrateTables() {
-	db.GetConn().AutoMigrate(&ermis.Alias{}, &ermis.Node{}, &ermis.Cname{}, &ermis.Alarm{}, &ermis.Relation{})
+	db.GetConn().AutoMigrate(&ermis.Alias{}, &ermis.Node{}, &ermis.Cname{}, &ermis.Alarm{}, &ermis.Relation{}, &ermis.AlarmEvent{}, &ermis.Silence{}, &ermis.QueuedNotification{}, &ermis.SecretRotation{}, &ermis.LoadSample{}, &ermis.LBDSnapshot{}, &lbclient.SeenSignature{}, &leader.Lease{})
 
 }
@@ -5,8 +5,11 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"gitlab.cern.ch/lb-experts/goermis/alarms"
 	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
 	"gitlab.cern.ch/lb-experts/goermis/api/lbclient"
+	"gitlab.cern.ch/lb-experts/goermis/leader"
+	"gitlab.cern.ch/lb-experts/goermis/scheduler"
 )
 
 //New Echo Context
@@ -28,13 +31,16 @@ func New() *echo.Echo {
 	//Custom middleware in API
 	lbweb.Use(ermis.CheckAuthorization)
 	//CSRF
-	lbweb.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+	csrf := middleware.CSRFWithConfig(middleware.CSRFConfig{
 		Skipper: middleware.DefaultSkipper, TokenLength: 32,
 		TokenLookup: "form:csrf", ContextKey: "csrf", CookieName: "_csrf", CookieMaxAge: 86400,
-	}))
+	})
+	lbweb.Use(csrf)
 
 	lbweb.GET("/", ermis.HomeHandler)
 	lbweb.GET("/api/v1/alias/", ermis.GetAlias)
+	lbweb.GET("/api/v1/alias/:id/alarms/history/", ermis.GetAlarmHistory)
+	lbweb.GET("/api/v1/alias/:id/load/", ermis.GetAliasLoad)
 	lbweb.GET("/create", ermis.CreateHandler)
 	lbweb.GET("/modify", ermis.ModifyHandler)
 	lbweb.GET("/display", ermis.DisplayHandler)
@@ -44,17 +50,70 @@ func New() *echo.Echo {
 	lbweb.POST("/delete_alias", ermis.DeleteAlias)
 	lbweb.POST("/modify_alias", ermis.ModifyAlias)
 	lbweb.GET("/checkname", ermis.CheckNameDNS)
+	lbweb.GET("/silences", ermis.SilencesHandler)
+	lbweb.GET("/api/v1/silences/", ermis.GetSilences)
+	//Silences are authorized in the handler, against the hostgroup they cover
+	e.POST("/lbweb/new_silence", ermis.CreateSilence, ermis.CheckIdentity, csrf)
+	e.POST("/lbweb/delete_silence", ermis.DeleteSilence, ermis.CheckIdentity, csrf)
 
 	//CLI routes
 	entrypoint := e.Group("/p/api/v1")
 	entrypoint.Use(ermis.CheckAuthorization)
 	entrypoint.GET("/raw/", ermis.GetAliasRaw)
 	entrypoint.GET("/alias/", ermis.GetAlias)
+	entrypoint.GET("/alias/export/", ermis.ExportAliases)
+	entrypoint.GET("/reconciler/", ermis.GetSyncStatus)
+	entrypoint.GET("/leader/", leader.GetStatus)
+	entrypoint.GET("/alarms/types/", alarms.GetAlarmTypes)
+	entrypoint.GET("/lbd/config/", ermis.GetLBDConfig)
+	entrypoint.GET("/lbd/config/generations/", ermis.GetLBDGenerations)
+	entrypoint.GET("/lbd/config/generations/:generation/", ermis.GetLBDGeneration)
+	entrypoint.GET("/lbd/config/diff/", ermis.DiffLBDGenerations)
 	entrypoint.DELETE("/alias/", ermis.DeleteAlias)
 	entrypoint.DELETE("/alias/force/", ermis.PurgeAlias)
 	entrypoint.POST("/alias/", ermis.CreateAlias)
 	entrypoint.PATCH("/alias/:id/", ermis.ModifyAlias)
 	entrypoint.PATCH("/alias/:id/force/", ermis.PurgeCname)
+	entrypoint.POST("/alias/:id/cnames/:cname/", ermis.AddCname)
+	entrypoint.DELETE("/alias/:id/cnames/:cname/", ermis.RemoveCname)
+	entrypoint.GET("/alias/:id/alarms/", ermis.GetAlarms)
+	entrypoint.GET("/alias/:id/alarms/history/", ermis.GetAlarmHistory)
+	entrypoint.GET("/alias/:id/load/", ermis.GetAliasLoad)
+	entrypoint.GET("/alias/:id/best_hosts/", ermis.GetBestHosts)
+	entrypoint.POST("/alias/:id/alarms/", ermis.AddAlarm)
+	entrypoint.POST("/alias/:id/alarms/check/", alarms.CheckAlarms)
+	entrypoint.PATCH("/alias/:id/alarms/:alarm/", ermis.ModifyAlarm)
+	entrypoint.GET("/alias/:id/secret/", ermis.GetSecretRotation)
+	entrypoint.POST("/alias/:id/secret/rotate/", ermis.RotateSecret)
+	entrypoint.DELETE("/alias/:id/alarms/:alarm/", ermis.RemoveAlarm)
+
+	//CLI routes acting on many aliases, every alias is authorized in the handler
+	bulk := e.Group("/p/api/v1/bulk")
+	bulk.Use(ermis.CheckIdentity)
+	bulk.POST("/", ermis.BulkAliases)
+	bulk.POST("/import/", ermis.ImportAliases)
+
+	//CLI routes for alarm silences, the hostgroup of every silence is authorized in the handler
+	silences := e.Group("/p/api/v1/silences")
+	silences.Use(ermis.CheckIdentity)
+	silences.GET("/", ermis.GetSilences)
+	silences.POST("/", ermis.CreateSilence)
+	silences.DELETE("/:id/", ermis.DeleteSilence)
+
+	//CLI routes for nodes, the hostgroup of every action is authorized in the handler
+	nodes := e.Group("/p/api/v1/nodes")
+	nodes.Use(ermis.CheckIdentity)
+	nodes.GET("/", ermis.GetNodes)
+	nodes.GET("/:name/", ermis.GetNode)
+	nodes.GET("/:name/load/", ermis.GetNodeLoad)
+	nodes.PATCH("/:name/", ermis.ModifyNode)
+	nodes.DELETE("/:name/", ermis.RemoveNode)
+
+	//Admin routes for the periodic jobs, only the superusers are allowed in the handlers
+	jobs := e.Group("/p/api/v1/jobs")
+	jobs.Use(ermis.CheckIdentity)
+	jobs.GET("/", scheduler.GetJobs)
+	jobs.POST("/:name/run/", scheduler.RunJob)
 
 	//lbclients
 	lbc := e.Group("/lb/api/v1")
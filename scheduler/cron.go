@@ -0,0 +1,131 @@
+package scheduler
+
+/*This file contains the parser of the cron expressions of the jobs.
+It understands the five standard fields(minute hour day-of-month month day-of-week)
+with lists, ranges and steps, e.g. "0,30 8-18 * * 1-5" runs every half hour of the working hours*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Cron is a parsed cron expression. Every field is the set of the values it accepts
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	//When both days are restricted, either of them matches, as in cron
+	domAny, dowAny bool
+}
+
+//bounds of the fields, in the order of the expression
+var bounds = []struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+//ParseCron parses a cron expression of five fields
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("wrong cron expression %q, expected 5 fields and got %d", expr, len(fields))
+	}
+	sets := make([]uint64, 5)
+	for i, field := range fields {
+		set, err := parseField(field, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("wrong cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	//Sunday is both 0 and 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &Cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+//parseField returns the set of values of a comma separated list of ranges with optional steps
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("wrong step in %q", part)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("wrong value in %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("wrong value in %q", part)
+				}
+			} else if step > 1 {
+				//"5/10" means from 5 until the end, every 10
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+//has returns true if the value is part of the set
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
+
+//matchesDay applies the day-of-month and day-of-week fields, as cron does
+func (c *Cron) matchesDay(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+//Next returns the first time after t that matches the expression, or the zero time if there is none
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	//Expressions like "0 0 30 2 *" never match, so we give up after some years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
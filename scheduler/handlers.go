@@ -0,0 +1,35 @@
+package scheduler
+
+/*This file contains the admin API of the scheduler*/
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/leader"
+)
+
+//GetJobs returns the status of the periodic jobs
+func GetJobs(c echo.Context) error {
+	if !ermis.IsSuperuser() {
+		return echo.NewHTTPError(http.StatusUnauthorized, ermis.GetUsername()+" is not an ermis admin")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"leader": leader.IsLeader(),
+		"jobs":   Statuses(),
+	})
+}
+
+//RunJob triggers a job right away, on this replica. The leader only jobs are refused unless it is the leader
+func RunJob(c echo.Context) error {
+	name := c.Param("name")
+	if !ermis.IsSuperuser() {
+		return echo.NewHTTPError(http.StatusUnauthorized, ermis.GetUsername()+" is not an ermis admin")
+	}
+	if err := Trigger(name); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	log.Infof("[%v] triggered the job %v", ermis.GetUsername(), name)
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "job " + name + " triggered"})
+}
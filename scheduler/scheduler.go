@@ -0,0 +1,249 @@
+package scheduler
+
+/*This file contains the scheduler of the periodic jobs. Every job runs on
+an interval or a cron expression, delayed by a random jitter. A job never
+overlaps with itself, the runs that find it busy are skipped. The jobs marked
+as leader only run on the replica that holds the lease. The schedule of a job
+can be overridden by name in the scheduler section of the config*/
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
+	"gitlab.cern.ch/lb-experts/goermis/leader"
+)
+
+type (
+	//Job is a task that runs periodically
+	Job struct {
+		Name string
+		//Either an interval or a cron expression
+		Interval time.Duration
+		Cron     string
+		//Maximum random delay added to every run
+		Jitter time.Duration
+		//LeaderOnly jobs run only on the replica that holds the lease
+		LeaderOnly bool
+		Run        func() error
+	}
+	//Status describes the runs of a job
+	Status struct {
+		Name     string     `json:"name"`
+		Schedule string     `json:"schedule"`
+		Running  bool       `json:"running"`
+		LastRun  *time.Time `json:"last_run,omitempty"`
+		Duration string     `json:"duration,omitempty"`
+		Error    string     `json:"error,omitempty"`
+		NextRun  *time.Time `json:"next_run,omitempty"`
+		Runs     int        `json:"runs"`
+		Skipped  int        `json:"skipped"`
+	}
+	//entry keeps a registered job with its state
+	entry struct {
+		sync.Mutex
+		job    Job
+		cron   *Cron
+		status Status
+	}
+)
+
+var (
+	log     = bootstrap.GetLog()
+	cfg     = bootstrap.GetConf()
+	mu      sync.RWMutex
+	entries = make(map[string]*entry)
+	stop    chan struct{}
+	started bool
+)
+
+//Register adds a job to the scheduler, applying the schedule of the config if there is one
+func Register(job Job) error {
+	if override, found := cfg.Scheduler.Jobs[job.Name]; found {
+		if override.Interval > 0 {
+			job.Interval, job.Cron = time.Duration(override.Interval)*time.Minute, ""
+		}
+		if override.Cron != "" {
+			job.Cron, job.Interval = override.Cron, 0
+		}
+		if override.Jitter > 0 {
+			job.Jitter = time.Duration(override.Jitter) * time.Second
+		}
+	}
+	e := &entry{job: job, status: Status{Name: job.Name}}
+	switch {
+	case job.Cron != "":
+		cron, err := ParseCron(job.Cron)
+		if err != nil {
+			return fmt.Errorf("failed to schedule the job %v: %v", job.Name, err)
+		}
+		e.cron = cron
+		e.status.Schedule = "cron " + job.Cron
+	case job.Interval > 0:
+		e.status.Schedule = "every " + job.Interval.String()
+	default:
+		return fmt.Errorf("failed to schedule the job %v: it needs an interval or a cron expression", job.Name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, found := entries[job.Name]; found {
+		return fmt.Errorf("the job %v is already registered", job.Name)
+	}
+	entries[job.Name] = e
+	if started {
+		go e.loop(stop)
+	}
+	log.Infof("Scheduled the job %v %v", job.Name, e.status.Schedule)
+	return nil
+}
+
+//Start runs the registered jobs on their schedule, until Stop is called
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+	if started {
+		return
+	}
+	started = true
+	stop = make(chan struct{})
+	for _, e := range entries {
+		go e.loop(stop)
+	}
+}
+
+//Stop ends the scheduling of the jobs. The runs in progress are not interrupted
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	if started {
+		close(stop)
+		started = false
+	}
+}
+
+/*Trigger runs a job right away, in the background. It fails if the job is unknown or already
+running. The leader only jobs must be triggered on the leader, otherwise they would run twice*/
+func Trigger(name string) error {
+	mu.RLock()
+	e, found := entries[name]
+	mu.RUnlock()
+	if !found {
+		return fmt.Errorf("the job %v does not exist", name)
+	}
+	if e.job.LeaderOnly && !leader.IsLeader() {
+		holder, err := leader.Holder()
+		if err != nil || holder == "" {
+			return fmt.Errorf("the job %v runs on the leader, which is unknown at the moment", name)
+		}
+		return fmt.Errorf("the job %v runs on the leader, not on this replica, retry against %v", name, holder)
+	}
+	if !e.begin() {
+		return fmt.Errorf("the job %v is already running", name)
+	}
+	log.Infof("The job %v was triggered manually", name)
+	go e.run()
+	return nil
+}
+
+//Statuses returns the status of every job, sorted by name
+func Statuses() (statuses []Status) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, e := range entries {
+		e.Lock()
+		statuses = append(statuses, e.status)
+		e.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+//next returns the time of the next run, including the jitter
+func (e *entry) next(now time.Time) time.Time {
+	var next time.Time
+	if e.cron != nil {
+		next = e.cron.Next(now)
+	} else {
+		next = now.Add(e.job.Interval)
+	}
+	if e.job.Jitter > 0 && !next.IsZero() {
+		next = next.Add(time.Duration(rand.Int63n(int64(e.job.Jitter))))
+	}
+	return next
+}
+
+//loop waits for the next run of the job, until the scheduler stops
+func (e *entry) loop(stop chan struct{}) {
+	for {
+		next := e.next(time.Now())
+		if next.IsZero() {
+			log.Errorf("The job %v will never run again", e.job.Name)
+			return
+		}
+		e.Lock()
+		e.status.NextRun = &next
+		e.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if e.job.LeaderOnly && !leader.IsLeader() {
+			log.Debugf("Not the leader, the job %v runs on another replica", e.job.Name)
+			continue
+		}
+		if !e.begin() {
+			log.Warnf("The job %v is still running, skipping this run", e.job.Name)
+			continue
+		}
+		e.run()
+	}
+}
+
+//begin marks the job as running, unless it already is
+func (e *entry) begin() bool {
+	e.Lock()
+	defer e.Unlock()
+	if e.status.Running {
+		e.status.Skipped++
+		return false
+	}
+	e.status.Running = true
+	return true
+}
+
+//run executes the job and keeps the outcome in its status. A panic fails the run, not ermis
+func (e *entry) run() {
+	var err error
+	start := time.Now()
+	log.Debugf("Running the job %v", e.job.Name)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		err = e.job.Run()
+	}()
+	if err != nil {
+		log.Errorf("The job %v failed: %v", e.job.Name, err)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.status.Running = false
+	e.status.LastRun = &start
+	e.status.Duration = time.Since(start).String()
+	e.status.Runs++
+	e.status.Error = ""
+	if err != nil {
+		e.status.Error = err.Error()
+	}
+}
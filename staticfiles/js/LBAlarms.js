@@ -21,7 +21,13 @@ function initialize_alarms(data, mode) {
         getControl: function (columnKey) {
             var disabled = "disabled='true'";
             if (columnKey == "type") {
-                return '<select class="form-control"><option value="minimum">Minimum hosts</option></select>';
+                return '<select class="form-control">' +
+                    '<option value="minimum">Minimum hosts</option>' +
+                    '<option value="maximum">Maximum hosts</option>' +
+                    '<option value="stale_load">Stale load (minutes)</option>' +
+                    '<option value="blacklisted_ratio">Blacklisted nodes (%)</option>' +
+                    '<option value="dns_mismatch">DNS mismatches</option>' +
+                    '</select>';
             } else if (columnKey == "recipient" || (columnKey == 'parameter')) {
                 disabled = ""
             }
@@ -29,8 +35,8 @@ function initialize_alarms(data, mode) {
         },
         validate: function (key, value) {
             if (key == "recipient") {
-                if (!validEmail(value)) {
-                    $("#alarms-name-status").html('<img src="/static/js/custom/images/dialog-error.png"</img> The email ' + value + ' is not valid!<img alt="Help" src="/static/js/custom/images/help-browser.png"</img></a><br/>');
+                if (!validRecipient(value)) {
+                    $("#alarms-name-status").html('<img src="/static/js/custom/images/dialog-error.png"</img> The recipient ' + value + ' is not valid!<img alt="Help" src="/static/js/custom/images/help-browser.png"</img></a><br/>');
                     $('#edit-submit').prop("disabled", true); //Disable submit button
                     return false;
                 }
@@ -57,6 +63,14 @@ function initialize_alarms(data, mode) {
     }
 
 }
+//Recipients are e-mails, optionally prefixed with mailto:, or named webhooks(webhook:name, mattermost:name)
+function validRecipient(value) {
+    if (/^(webhook|mattermost):[\w\-\.]+$/.test(value)) {
+        return true;
+    }
+    return validEmail(value.replace(/^mailto:/, ""));
+}
+
 function validEmail(value) {
     if (/^\w+([\.-]?\w+)*@\w+([\.-]?\w+)*(\.\w{2,3})+$/.test(value)) {
         return true;
@@ -71,13 +85,19 @@ function DisplayAlarms(data) {
     if (data) {
         alarms = data
         for (var i = 0; i < alarms.length; i++) {
+            //The recipient and the last active time may contain colons,
+            //so the fields are located around the active flag
             info = (alarms[i]).split(":")
+            var flag = 3;
+            while (flag < info.length && info[flag] != "true" && info[flag] != "false") {
+                flag++;
+            }
             datalist.push({
                 "type": info[0],
-                "recipient": info[1],
-                "parameter": info[2],
-                "active": info[3],
-                "last_active": info[4]
+                "recipient": info.slice(1, flag - 1).join(":"),
+                "parameter": info[flag - 1],
+                "active": info[flag],
+                "last_active": info.slice(flag + 1).join(":")
             })
         }
     }
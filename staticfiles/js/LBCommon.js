@@ -265,7 +265,7 @@ function populateClass(name, clusterObject) {
   else { visibility = false; }
   //alert(JSON.stringify(cluster));
   clusterObject.setCluster(name, visibility, replies, hostgroup, cnames);
-  DisplayReceivedNodes(cluster.AllowedNodes, cluster.ForbiddenNodes);
+  DisplayReceivedNodes(cluster.AllowedNodes, cluster.ForbiddenNodes, cluster.stale_nodes);
   DisplayAlarms(cluster.alarms);
   return;
 }
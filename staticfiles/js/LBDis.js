@@ -14,8 +14,95 @@
 
 		$('#clusterList').change(function () {
 			loadCluster($('#clusterList').val(), newCluster, false);
+			loadAlarmHistory($('#clusterList').val());
+			loadLoadHistory($('#clusterList').val());
 		});
 	});
 
+	//Fills the alarm history table with the state changes of the selected alias
+	function loadAlarmHistory(name) {
+		var body = $("#myAlarmHistory tbody");
+		body.empty();
+		if (name === SelectInitVal) {
+			return;
+		}
+		var alias = getClusterAliasData(name);
+		$.get('api/v1/alias/' + alias.alias_id + '/alarms/history/', function (events) {
+			jQuery.each(events, function (index, e) {
+				body.append($("<tr></tr>")
+					.append($("<td></td>").text(new Date(e.time).toLocaleString()))
+					.append($("<td></td>").text(e.name))
+					.append($("<td></td>").text(e.old_state))
+					.append($("<td></td>").text(e.new_state))
+					.append($("<td></td>").text(e.value)));
+			});
+		});
+	}
+
+	//Draws the load of every node of the selected alias, averaged over 10 minutes
+	function loadLoadHistory(name) {
+		var svg = $("#myLoadHistory");
+		var legend = $("#myLoadHistoryLegend");
+		svg.empty();
+		legend.empty();
+		if (name === SelectInitVal) {
+			return;
+		}
+		var alias = getClusterAliasData(name);
+		$.get('api/v1/alias/' + alias.alias_id + '/load/', { step: 600 }, function (series) {
+			drawLoadHistory(svg, legend, series);
+		});
+	}
+
+	function drawLoadHistory(svg, legend, series) {
+		var colors = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"];
+		var width = svg.attr("width"), height = svg.attr("height"), margin = 40;
+		var minTime = Infinity, maxTime = -Infinity, maxLoad = 0;
+		if (series.length === 0) {
+			legend.text("No load reported in this period");
+			return;
+		}
+		series.forEach(function (s) {
+			s.points.forEach(function (p) {
+				var t = new Date(p.time).getTime();
+				minTime = Math.min(minTime, t);
+				maxTime = Math.max(maxTime, t);
+				maxLoad = Math.max(maxLoad, p.load);
+			});
+		});
+		var x = function (t) {
+			return margin + (maxTime === minTime ? 0 : (t - minTime) / (maxTime - minTime)) * (width - 2 * margin);
+		};
+		var y = function (load) {
+			return height - margin - (maxLoad === 0 ? 0 : load / maxLoad) * (height - 2 * margin);
+		};
+		var ns = "http://www.w3.org/2000/svg";
+		function add(tag, attributes, text) {
+			var element = document.createElementNS(ns, tag);
+			for (var key in attributes) {
+				element.setAttribute(key, attributes[key]);
+			}
+			if (text !== undefined) {
+				element.textContent = text;
+			}
+			svg[0].appendChild(element);
+		}
+		//Axes, with the range of the values
+		add("line", { x1: margin, y1: height - margin, x2: width - margin, y2: height - margin, stroke: "black" });
+		add("line", { x1: margin, y1: margin, x2: margin, y2: height - margin, stroke: "black" });
+		add("text", { x: margin - 5, y: margin, "text-anchor": "end", "font-size": 10 }, maxLoad);
+		add("text", { x: margin - 5, y: height - margin, "text-anchor": "end", "font-size": 10 }, 0);
+		add("text", { x: margin, y: height - margin + 15, "font-size": 10 }, new Date(minTime).toLocaleString());
+		add("text", { x: width - margin, y: height - margin + 15, "text-anchor": "end", "font-size": 10 }, new Date(maxTime).toLocaleString());
+		series.forEach(function (s, index) {
+			var color = colors[index % colors.length];
+			var points = s.points.map(function (p) {
+				return x(new Date(p.time).getTime()) + "," + y(p.load);
+			}).join(" ");
+			add("polyline", { points: points, fill: "none", stroke: color, "stroke-width": 1.5 });
+			legend.append($("<span></span>").css({ color: color, margin: "0 10px" }).text(s.node_name));
+		});
+	}
+
 
 })(jQuery)
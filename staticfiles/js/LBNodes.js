@@ -16,13 +16,17 @@ function initialize_nodes(data, mode) {
         {
             text: "Last Load Update",
             key: "lastloadupdate"
+        },
+        {
+            text: "Status",
+            key: "status"
         }],
         getControl: function (columnKey) {
             var disabled = "disabled='true'";
             if (columnKey == "access") {
                 return '<select class="form-control"><option value="0">Allow</option><option value="1">Forbidden</option></select>';
             }
-            if (columnKey == "load" || columnKey=="lastloadupdate"){
+            if (columnKey == "load" || columnKey=="lastloadupdate" || columnKey=="status"){
                 return '<input type="text" class="form-control" ' + disabled + '/>';
             }
             return '<input type="text" class="form-control" />';
@@ -54,8 +58,13 @@ function initialize_nodes(data, mode) {
    
 }
 //FUnction that populates the table with the received data
-function DisplayReceivedNodes(AllowedNodes, ForbiddenNodes) {
+function DisplayReceivedNodes(AllowedNodes, ForbiddenNodes, StaleNodes) {
     var KeyValue = [];
+    //Nodes that stopped reporting their load
+    var stale = (StaleNodes != null) ? StaleNodes : [];
+    function nodeStatus(name) {
+        return (stale.indexOf(name) != -1) ? "stale" : "";
+    }
     //Split and filter the allowed nodes, push them in the array
     if (AllowedNodes != null) {
         var allowed = AllowedNodes.filter(Boolean);
@@ -65,7 +74,8 @@ function DisplayReceivedNodes(AllowedNodes, ForbiddenNodes) {
                 "name": entry.split(':')[0],
                 "access": 0,
                 "load":entry.split(':')[1],
-                "lastloadupdate": entry.split(":")[2]
+                "lastloadupdate": entry.split(":")[2],
+                "status": nodeStatus(entry.split(':')[0])
             });
         })
     }
@@ -77,7 +87,8 @@ function DisplayReceivedNodes(AllowedNodes, ForbiddenNodes) {
                 "name": entry.split(':')[0], //remove load value
                 "access": 1,
                 "load":entry.split(':')[1],
-                "lastloadupdate": entry.split(":")[2]
+                "lastloadupdate": entry.split(":")[2],
+                "status": nodeStatus(entry.split(':')[0])
             });
         })
     }
@@ -0,0 +1,38 @@
+/**
+ * LBSilences - Javascript side code for the alarm silences of LBWeb
+ */
+
+(function ($) {
+
+        $(document).ready(function () {
+                loadSilences('api/v1/silences/');
+        });
+
+        //Fills the table with the active and upcoming silences
+        function loadSilences(URI) {
+                var body = $("#mySilences tbody");
+                $.get(URI, function (silences) {
+                        jQuery.each(silences, function (index, s) {
+                                if (new Date(s.end) < new Date()) {
+                                        return;
+                                }
+                                var remove = $("<button type='button' class='btn'></button>")
+                                        .text("Delete")
+                                        .click(function () {
+                                                $("#delete-silence-id").val(s.silence_id);
+                                                $("#delete-silence-form").submit();
+                                        });
+                                body.append($("<tr></tr>")
+                                        .append($("<td></td>").text(s.hostgroup))
+                                        .append($("<td></td>").text(s.alias_name))
+                                        .append($("<td></td>").text(s.alarm_id || ""))
+                                        .append($("<td></td>").text(new Date(s.start).toLocaleString()))
+                                        .append($("<td></td>").text(new Date(s.end).toLocaleString()))
+                                        .append($("<td></td>").text(s.creator))
+                                        .append($("<td></td>").text(s.reason))
+                                        .append($("<td></td>").append(remove)));
+                        });
+                });
+        }
+
+})(jQuery)
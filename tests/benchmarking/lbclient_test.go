@@ -0,0 +1,76 @@
+package ci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/api/lbclient"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+const (
+	benchNodes   = 1000
+	benchAliases = 10
+)
+
+/*BenchmarkLBClientReports measures the reports of 1000 nodes in 10 aliases each.
+It needs the database of the config file, and skips without it. The first round
+registers the nodes, the rest update their load*/
+func BenchmarkLBClientReports(b *testing.B) {
+	var statuses []lbclient.Status
+	if err := db.InitDB(); err != nil {
+		b.Skipf("no database available: %v", err)
+	}
+	lbclient.SecretOf = func(string) string { return "benchmark" }
+
+	aliases := make([]ermis.Alias, benchAliases)
+	for i := range aliases {
+		aliases[i] = ermis.Alias{
+			AliasName: fmt.Sprintf("bench-alias-%d.cern.ch", i),
+			BestHosts: 1,
+			External:  "no",
+			Hostgroup: "benchmark",
+		}
+		statuses = append(statuses, lbclient.Status{AliasName: aliases[i].AliasName, Secret: "benchmark", Load: i})
+	}
+	if err := db.GetConn().Create(&aliases).Error; err != nil {
+		b.Fatalf("failed to create the aliases of the benchmark: %v", err)
+	}
+	defer cleanBenchmark(aliases)
+	body, _ := json.Marshal(statuses)
+
+	e := echo.New()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < benchNodes; n++ {
+			req := httptest.NewRequest(http.MethodPost, "/lb/api/v1/lbclient/", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("NameFromCert", fmt.Sprintf("bench-node-%d.cern.ch", n))
+			rec := httptest.NewRecorder()
+			if err := lbclient.PostHandler(e.NewContext(req, rec)); err != nil || rec.Code != http.StatusOK {
+				b.Fatalf("report of node %d failed: %v %v", n, err, rec.Body.String())
+			}
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N*benchNodes)/time.Since(start).Seconds(), "reports/s")
+}
+
+//cleanBenchmark removes the aliases, nodes and relations of the benchmark
+func cleanBenchmark(aliases []ermis.Alias) {
+	var ids []int
+	for _, a := range aliases {
+		ids = append(ids, a.ID)
+	}
+	db.GetConn().Where("alias_id IN ?", ids).Delete(&ermis.Relation{})
+	db.GetConn().Where("node_name LIKE ?", "bench-node-%").Delete(&ermis.Node{})
+	db.GetConn().Where("id IN ?", ids).Delete(&ermis.Alias{})
+}
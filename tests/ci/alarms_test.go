@@ -1,9 +1,14 @@
 package ci
 
 import (
+	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
 	"gitlab.cern.ch/lb-experts/goermis/alarms"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/bootstrap"
 )
 
 func TestCheckMinimumAlarm(t *testing.T) {
@@ -11,34 +16,34 @@ func TestCheckMinimumAlarm(t *testing.T) {
 		caseID   int
 		input1   string
 		input2   int
-		expected bool
+		expected string
 	}
 	testCases := []test{
 		//Case1: Correct fields
 		{caseID: 1,
 			input1:   "goermis.cern.ch",
 			input2:   1,
-			expected: false},
+			expected: ermis.StateOK},
 		//Case2: Without domain name, it should not find any
 		{caseID: 2,
 			input1:   "goermis",
 			input2:   1,
-			expected: true},
+			expected: ermis.StateFiring},
 		//Case3: Number of nodes smaller than the threshold(1 node, threshold is 5)
 		{caseID: 3,
 			input1:   "goermis.cern.ch",
 			input2:   5,
-			expected: true},
+			expected: ermis.StateFiring},
 		//Case4: Malformed alias
 		{caseID: 4,
 			input1:   "@!?>",
 			input2:   5,
-			expected: true},
+			expected: ermis.StateFiring},
 		//Case5: 0 threshold
 		{caseID: 4,
 			input1:   "goermis.cern.ch",
 			input2:   0,
-			expected: false},
+			expected: ermis.StateOK},
 	}
 	for _, tc := range testCases {
 		output := alarms.CheckMinimumAlarm(tc.input1, tc.input2)
@@ -48,3 +53,227 @@ func TestCheckMinimumAlarm(t *testing.T) {
 	}
 
 }
+
+func TestAlarmCheckers(t *testing.T) {
+	alias := ermis.Alias{
+		AliasName: "seed.cern.ch",
+		Relations: []ermis.Relation{
+			{Blacklist: true, LastLoadUpdate: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}},
+			{Blacklist: false, LastLoadUpdate: sql.NullTime{Time: time.Now().Add(-10 * time.Minute), Valid: true}},
+			{Blacklist: false},
+		},
+	}
+	type test struct {
+		caseID    int
+		name      string
+		parameter int
+		expected  string
+	}
+	testCases := []test{
+		//Case1: One out of three nodes is blacklisted
+		{caseID: 1, name: "blacklisted_ratio", parameter: 50, expected: ermis.StateOK},
+		{caseID: 2, name: "blacklisted_ratio", parameter: 30, expected: ermis.StateFiring},
+		//Case3: The last report is 10 minutes old
+		{caseID: 3, name: "stale_load", parameter: 15, expected: ermis.StateOK},
+		{caseID: 4, name: "stale_load", parameter: 5, expected: ermis.StateFiring},
+	}
+	for _, tc := range testCases {
+		checker, found := alarms.GetChecker(tc.name)
+		if !found {
+			t.Errorf("Failed in TestAlarmCheckers for case ID:%v, alarm type %v is not registered", tc.caseID, tc.name)
+			continue
+		}
+		output, _ := checker.Check(alias, tc.parameter)
+		if output != tc.expected {
+			t.Errorf("Failed in TestAlarmCheckers for case ID:%v\nALARM:%v\nPARAMETER:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.name, tc.parameter, tc.expected, output)
+		}
+	}
+}
+
+func TestCurrentState(t *testing.T) {
+	type test struct {
+		caseID   int
+		alarm    ermis.Alarm
+		expected string
+	}
+	testCases := []test{
+		//Case1: Alarms checked before the states existed follow their active flag
+		{caseID: 1, alarm: ermis.Alarm{Active: true}, expected: ermis.StateFiring},
+		{caseID: 2, alarm: ermis.Alarm{Active: false}, expected: ermis.StateOK},
+		//Case3: An alarm that could not be evaluated stays unknown, whatever it was before
+		{caseID: 3, alarm: ermis.Alarm{Active: true, State: ermis.StateUnknown}, expected: ermis.StateUnknown},
+	}
+	for _, tc := range testCases {
+		output := tc.alarm.CurrentState()
+		if output != tc.expected {
+			t.Errorf("Failed in TestCurrentState for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestSilenced(t *testing.T) {
+	alias := ermis.Alias{AliasName: "seed.cern.ch", Hostgroup: "aiermis"}
+	alarm := ermis.Alarm{ID: 7}
+	type test struct {
+		caseID   int
+		silence  ermis.Silence
+		expected bool
+	}
+	testCases := []test{
+		//Case1: The whole hostgroup is silenced
+		{caseID: 1, silence: ermis.Silence{Hostgroup: "aiermis"}, expected: true},
+		//Case2: Another alias of the hostgroup is silenced
+		{caseID: 2, silence: ermis.Silence{Hostgroup: "aiermis", Alias: "other.cern.ch"}, expected: false},
+		//Case3: Only this alarm is silenced
+		{caseID: 3, silence: ermis.Silence{Hostgroup: "aiermis", Alias: "seed.cern.ch", AlarmID: 7}, expected: true},
+		//Case4: Another alarm of the alias is silenced
+		{caseID: 4, silence: ermis.Silence{Hostgroup: "aiermis", AlarmID: 8}, expected: false},
+		//Case5: Another hostgroup is silenced
+		{caseID: 5, silence: ermis.Silence{Hostgroup: "ailbd"}, expected: false},
+	}
+	for _, tc := range testCases {
+		output := ermis.Silenced([]ermis.Silence{tc.silence}, alias, alarm)
+		if output != tc.expected {
+			t.Errorf("Failed in TestSilenced for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	alarm := ermis.Alarm{ID: 7}
+	type test struct {
+		caseID    int
+		hostgroup string
+		silence   ermis.Silence
+		expected  bool
+	}
+	testCases := []test{
+		//Case1: The hostgroup of the alias
+		{caseID: 1, hostgroup: "aiermis", silence: ermis.Silence{Hostgroup: "aiermis"}, expected: true},
+		//Case2: A sub-hostgroup of the silenced one
+		{caseID: 2, hostgroup: "aiermis/lb/nodes", silence: ermis.Silence{Hostgroup: "aiermis"}, expected: true},
+		//Case3: A sub-hostgroup, restricted to another alias
+		{caseID: 3, hostgroup: "aiermis/lb", silence: ermis.Silence{Hostgroup: "aiermis", Alias: "other.cern.ch"}, expected: false},
+		//Case4: A hostgroup that only shares the prefix of the name
+		{caseID: 4, hostgroup: "aiermis2", silence: ermis.Silence{Hostgroup: "aiermis"}, expected: false},
+		//Case5: The parent of the silenced hostgroup
+		{caseID: 5, hostgroup: "aiermis", silence: ermis.Silence{Hostgroup: "aiermis/lb"}, expected: false},
+	}
+	for _, tc := range testCases {
+		output := tc.silence.Covers(ermis.Alias{AliasName: "seed.cern.ch", Hostgroup: tc.hostgroup}, alarm)
+		if output != tc.expected {
+			t.Errorf("Failed in TestCovers for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestStaleNodes(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	reported := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+	type test struct {
+		caseID   int
+		alias    ermis.Alias
+		relation ermis.Relation
+		expected bool
+	}
+	testCases := []test{
+		//Case1: Recent report
+		{caseID: 1, relation: ermis.Relation{LastLoadUpdate: reported(10 * time.Minute)}, expected: false},
+		//Case2: No report for longer than the default period
+		{caseID: 2, relation: ermis.Relation{LastLoadUpdate: reported(45 * time.Minute)}, expected: true},
+		//Case3: The alias allows a longer period
+		{caseID: 3, alias: ermis.Alias{StalePeriod: 60},
+			relation: ermis.Relation{LastLoadUpdate: reported(45 * time.Minute)}, expected: false},
+		//Case4: Nodes that never reported are not stale
+		{caseID: 4, relation: ermis.Relation{}, expected: false},
+	}
+	for _, tc := range testCases {
+		output := tc.relation.IsStale(ermis.StalePeriod(tc.alias), now)
+		if output != tc.expected {
+			t.Errorf("Failed in TestStaleNodes for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+	firing := ermis.Alarm{Name: "minimum", Alias: "seed.cern.ch", Active: true, State: ermis.StateFiring,
+		Failures: 1, LastActive: before(30 * time.Minute), LastNotification: before(30 * time.Minute)}
+	const (
+		F = ermis.StateFiring
+		O = ermis.StateOK
+	)
+	type test struct {
+		caseID        int
+		policy        bootstrap.AlarmPolicy
+		alarm         ermis.Alarm
+		results       []string
+		notifications []string
+		states        []string
+	}
+	testCases := []test{
+		//Case1: An ok alarm is pending until it fails fire_after consecutive checks, then it fires
+		{caseID: 1, policy: bootstrap.AlarmPolicy{FireAfter: 3}, alarm: ermis.Alarm{State: O},
+			results:       []string{F, F, F},
+			notifications: []string{"", "", "firing"},
+			states:        []string{O, O, F}},
+		//Case2: A success resets the failures of a pending alarm
+		{caseID: 2, policy: bootstrap.AlarmPolicy{FireAfter: 2}, alarm: ermis.Alarm{State: O},
+			results:       []string{F, O, F, O},
+			notifications: []string{"", "", "", ""},
+			states:        []string{O, O, O, O}},
+		//Case3: A firing alarm resolves after resolve_after consecutive successes
+		{caseID: 3, policy: bootstrap.AlarmPolicy{ResolveAfter: 2}, alarm: firing,
+			results:       []string{O, O},
+			notifications: []string{"", "resolved"},
+			states:        []string{F, O}},
+		//Case4: A flapping alarm neither resolves nor notifies again inside the renotify cooldown
+		{caseID: 4, policy: bootstrap.AlarmPolicy{ResolveAfter: 2, Renotify: 60}, alarm: firing,
+			results:       []string{O, F, O, F, O, F},
+			notifications: []string{"", "", "", "", "", ""},
+			states:        []string{F, F, F, F, F, F}},
+		//Case5: Once the cooldown is over the recipient is reminded, and only once
+		{caseID: 5, policy: bootstrap.AlarmPolicy{Renotify: 30}, alarm: firing,
+			results:       []string{F, F},
+			notifications: []string{"firing", ""},
+			states:        []string{F, F}},
+		//Case6: The resolved notification is sent by default
+		{caseID: 6, policy: bootstrap.AlarmPolicy{}, alarm: firing,
+			results:       []string{O},
+			notifications: []string{"resolved"},
+			states:        []string{O}},
+		//Case7: The alarm still resolves when the resolved notifications are disabled, silently
+		{caseID: 7, policy: bootstrap.AlarmPolicy{SkipResolved: true}, alarm: firing,
+			results:       []string{O},
+			notifications: []string{""},
+			states:        []string{O}},
+		//Case8: An alarm that cannot be evaluated keeps its counters and notifies nothing
+		{caseID: 8, policy: bootstrap.AlarmPolicy{FireAfter: 2}, alarm: ermis.Alarm{State: O},
+			results:       []string{F, ermis.StateUnknown, F},
+			notifications: []string{"", "", "firing"},
+			states:        []string{O, ermis.StateUnknown, F}},
+	}
+	for _, tc := range testCases {
+		var notifications, states []string
+		alarm := tc.alarm
+		for i, result := range tc.results {
+			var notification string
+			checked := now.Add(time.Duration(i) * time.Minute)
+			alarm, _, notification = alarms.ApplyPolicy(tc.policy, alarm, result, 0, false, checked)
+			if notification != "" {
+				alarm.LastNotification = alarm.LastCheck
+			}
+			notifications = append(notifications, notification)
+			states = append(states, alarm.State)
+		}
+		if fmt.Sprint(notifications) != fmt.Sprint(tc.notifications) || fmt.Sprint(states) != fmt.Sprint(tc.states) {
+			t.Errorf("Failed in TestApplyPolicy for case ID:%v\nEXPECTED:%v %v\nRECEIVED:%v %v\n",
+				tc.caseID, tc.notifications, tc.states, notifications, states)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ci
+
+import (
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+func TestResolveHostgroups(t *testing.T) {
+	registered := map[string]ermis.Alias{
+		"victim.cern.ch": {ID: 1, AliasName: "victim.cern.ch", Hostgroup: "victim/hg"},
+		"1":              {ID: 1, AliasName: "victim.cern.ch", Hostgroup: "victim/hg"},
+		"mine.cern.ch":   {ID: 2, AliasName: "mine.cern.ch", Hostgroup: "mine/hg"},
+	}
+	lookup := func(param string) []ermis.Alias {
+		if alias, found := registered[param]; found {
+			return []ermis.Alias{alias}
+		}
+		return nil
+	}
+	type test struct {
+		caseID    int
+		pathID    string
+		requested string
+		newHg     string
+		expectOld string
+		expectErr bool
+	}
+	testCases := []test{
+		//Case1: A sub-resource of an alias is authorized against the alias of the path
+		{caseID: 1, pathID: "victim", expectOld: "victim/hg"},
+		{caseID: 2, pathID: "1", expectOld: "victim/hg"},
+		//Case3: The alias of the body may repeat the one of the path
+		{caseID: 3, pathID: "victim", requested: "victim.cern.ch", expectOld: "victim/hg"},
+		{caseID: 4, pathID: "1", requested: "victim", expectOld: "victim/hg"},
+		//Case5: An alias of another hostgroup in the body is refused, instead of being authorized
+		{caseID: 5, pathID: "victim", requested: "mine.cern.ch", expectErr: true},
+		{caseID: 6, pathID: "1", requested: "mine", newHg: "mine/hg", expectErr: true},
+		//Case7: Without an alias in the path, the alias of the body is authorized
+		{caseID: 7, requested: "mine.cern.ch", expectOld: "mine/hg"},
+		//Case8: Creation of a new alias, only the hostgroup of the request exists
+		{caseID: 8, requested: "new.cern.ch", newHg: "mine/hg", expectOld: ""},
+	}
+	for _, tc := range testCases {
+		_, oldHg, err := ermis.ResolveHostgroups(tc.pathID, tc.requested, tc.newHg, lookup)
+		if (err != nil) != tc.expectErr || oldHg != tc.expectOld {
+			t.Errorf("Failed in TestResolveHostgroups for case ID:%v\nEXPECTED:%v (error %v)\nRECEIVED:%v (%v)\n",
+				tc.caseID, tc.expectOld, tc.expectErr, oldHg, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+func TestPlanOperations(t *testing.T) {
+	existing := map[string]ermis.Alias{
+		"bulk-a.cern.ch": {AliasName: "bulk-a.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1},
+		"bulk-b.cern.ch": {AliasName: "bulk-b.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1},
+	}
+	patch := func(name string, bestHosts int) ermis.Operation {
+		return ermis.Operation{Action: "patch", Alias: ermis.Resource{AliasName: name, BestHosts: bestHosts}}
+	}
+	type test struct {
+		caseID     int
+		superuser  bool
+		operations []ermis.Operation
+		statuses   []int
+		plans      int
+		failed     bool
+	}
+	testCases := []test{
+		//Case1: Valid operations are planned
+		{caseID: 1, superuser: true,
+			operations: []ermis.Operation{patch("bulk-a.cern.ch", 2), {Action: "delete", Alias: ermis.Resource{AliasName: "bulk-b.cern.ch"}}},
+			statuses:   []int{0, 0}, plans: 2, failed: false},
+		//Case2: An alias that appears twice in the request is only planned once
+		{caseID: 2, superuser: true,
+			operations: []ermis.Operation{patch("bulk-a.cern.ch", 2), {Action: "delete", Alias: ermis.Resource{AliasName: "bulk-a.cern.ch"}}},
+			statuses:   []int{0, http.StatusConflict}, plans: 1, failed: true},
+		//Case3: An unknown action
+		{caseID: 3, superuser: true,
+			operations: []ermis.Operation{{Action: "rename", Alias: ermis.Resource{AliasName: "bulk-a.cern.ch"}}, patch("bulk-b.cern.ch", 2)},
+			statuses:   []int{http.StatusBadRequest, 0}, plans: 1, failed: true},
+		//Case4: Aliases that do not exist cannot be patched or deleted
+		{caseID: 4, superuser: true,
+			operations: []ermis.Operation{patch("bulk-none.cern.ch", 2), {Action: "delete", Alias: ermis.Resource{AliasName: "bulk-none2.cern.ch"}}},
+			statuses:   []int{http.StatusNotFound, http.StatusNotFound}, plans: 0, failed: true},
+		//Case5: The user is not authorized in the hostgroup of the aliases
+		{caseID: 5, superuser: false,
+			operations: []ermis.Operation{patch("bulk-a.cern.ch", 2), {Action: "delete", Alias: ermis.Resource{AliasName: "bulk-b.cern.ch"}}},
+			statuses:   []int{http.StatusUnauthorized, http.StatusUnauthorized}, plans: 0, failed: true},
+		//Case6: An invalid value
+		{caseID: 6, superuser: true,
+			operations: []ermis.Operation{patch("bulk-a.cern.ch", -5)},
+			statuses:   []int{http.StatusBadRequest}, plans: 0, failed: true},
+	}
+	defer ermis.SetUserProfile(ermis.User{})
+	for _, tc := range testCases {
+		ermis.SetUserProfile(ermis.User{Username: "bulk", Superuser: tc.superuser})
+		response := ermis.BulkResponse{}
+		plans, failed := ermis.PlanOperations(tc.operations, existing, &response)
+		var statuses []int
+		for _, result := range response.Results {
+			statuses = append(statuses, result.Status)
+		}
+		if fmt.Sprint(statuses) != fmt.Sprint(tc.statuses) || len(plans) != tc.plans || failed != tc.failed {
+			t.Errorf("Failed in TestPlanOperations for case ID:%v\nEXPECTED:%v %v %v\nRECEIVED:%v %v %v\n",
+				tc.caseID, tc.statuses, tc.plans, tc.failed, statuses, len(plans), failed)
+		}
+	}
+}
+
+func TestBulkAliases(t *testing.T) {
+	requireDB(t)
+	names := []string{"bulk-a.cern.ch", "bulk-b.cern.ch", "bulk-c.cern.ch"}
+	for _, name := range names {
+		alias := ermis.Alias{AliasName: name, Hostgroup: "aiermis", External: "no", BestHosts: 1}
+		if err := ermis.CreateTransactions(db.GetConn(), alias); err != nil {
+			t.Fatalf("failed to create the alias %v of the test: %v", name, err)
+		}
+	}
+	defer cleanAliases(t, names...)
+	ermis.SetUserProfile(ermis.User{Username: "bulk", Superuser: true})
+	defer ermis.SetUserProfile(ermis.User{})
+
+	//bestHosts returns the best hosts stored for each alias of the test
+	bestHosts := func() []int {
+		var values []int
+		for _, name := range names {
+			retrieved, err := ermis.GetObjectsByName([]string{name})
+			if err != nil || len(retrieved) != 1 {
+				return nil
+			}
+			values = append(values, retrieved[0].BestHosts)
+		}
+		return values
+	}
+	type test struct {
+		caseID    int
+		body      string
+		status    int
+		results   []int
+		bestHosts []int
+	}
+	testCases := []test{
+		//Case1: Atomic mode applies nothing when an operation is invalid
+		{caseID: 1, body: `{"operations":[
+			{"action":"patch","alias":{"alias_name":"bulk-a","best_hosts":2}},
+			{"action":"rename","alias":{"alias_name":"bulk-b"}}]}`,
+			status: http.StatusBadRequest, results: []int{http.StatusFailedDependency, http.StatusBadRequest}, bestHosts: []int{1, 1, 1}},
+		//Case2: Atomic mode refuses an alias that appears twice
+		{caseID: 2, body: `{"mode":"atomic","operations":[
+			{"action":"patch","alias":{"alias_name":"bulk-a","best_hosts":2}},
+			{"action":"patch","alias":{"alias_name":"bulk-a","best_hosts":3}}]}`,
+			status: http.StatusBadRequest, results: []int{http.StatusFailedDependency, http.StatusConflict}, bestHosts: []int{1, 1, 1}},
+		//Case3: Best effort mode applies the valid operations and reports the others
+		{caseID: 3, body: `{"mode":"best_effort","operations":[
+			{"action":"patch","alias":{"alias_name":"bulk-a","best_hosts":2}},
+			{"action":"rename","alias":{"alias_name":"bulk-b"}},
+			{"action":"patch","alias":{"alias_name":"bulk-none","best_hosts":2}}]}`,
+			status: http.StatusMultiStatus, results: []int{http.StatusAccepted, http.StatusBadRequest, http.StatusNotFound}, bestHosts: []int{2, 1, 1}},
+		//Case4: Atomic mode applies all the operations when they are all valid
+		{caseID: 4, body: `{"operations":[
+			{"action":"patch","alias":{"alias_name":"bulk-b","best_hosts":2}},
+			{"action":"patch","alias":{"alias_name":"bulk-c","best_hosts":2}}]}`,
+			status: http.StatusOK, results: []int{http.StatusAccepted, http.StatusAccepted}, bestHosts: []int{2, 2, 2}},
+		/*Case5: The new cname of bulk-b cannot be created in DNS, for an alias that is not delegated.
+		The failure is reported after its own rollback, the applied operation is rolled back
+		and the pending one is not applied*/
+		{caseID: 5, body: `{"operations":[
+			{"action":"patch","alias":{"alias_name":"bulk-a","best_hosts":3}},
+			{"action":"patch","alias":{"alias_name":"bulk-b","cnames":["bulk-cname"]}},
+			{"action":"patch","alias":{"alias_name":"bulk-c","best_hosts":3}}]}`,
+			status: http.StatusBadRequest, results: []int{http.StatusAccepted, http.StatusAccepted, http.StatusFailedDependency}, bestHosts: []int{2, 2, 2}},
+	}
+	for _, tc := range testCases {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		response := ermis.BulkResponse{}
+		var results []int
+		if err := ermis.BulkAliases(e.NewContext(req, rec)); err != nil {
+			t.Errorf("Failed in TestBulkAliases for case ID:%v\nERROR:%v\n", tc.caseID, err)
+			continue
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Errorf("Failed in TestBulkAliases for case ID:%v\nERROR:%v\n", tc.caseID, err)
+			continue
+		}
+		for _, result := range response.Results {
+			results = append(results, result.Status)
+		}
+		if rec.Code != tc.status || fmt.Sprint(results) != fmt.Sprint(tc.results) || fmt.Sprint(bestHosts()) != fmt.Sprint(tc.bestHosts) {
+			t.Errorf("Failed in TestBulkAliases for case ID:%v\nEXPECTED:%v %v %v\nRECEIVED:%v %v %v\n",
+				tc.caseID, tc.status, tc.results, tc.bestHosts, rec.Code, results, bestHosts())
+		}
+		if tc.caseID == 5 && !strings.Contains(response.Results[1].Message, "rolled back") {
+			t.Errorf("Failed in TestBulkAliases for case ID:%v\nEXPECTED:the failure after the rollback\nRECEIVED:%v\n",
+				tc.caseID, response.Results[1].Message)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ci
+
+import (
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+/*requireDB connects to the database of the config file and migrates the tables
+of the tests. The tests that need it are skipped without a database*/
+func requireDB(t *testing.T) {
+	if err := db.InitDB(); err != nil {
+		t.Skipf("no database available: %v", err)
+	}
+	if err := db.GetConn().AutoMigrate(&ermis.Alias{}, &ermis.Node{}, &ermis.Cname{}, &ermis.Alarm{}, &ermis.Relation{}); err != nil {
+		t.Fatalf("failed to migrate the tables: %v", err)
+	}
+}
+
+//cleanAliases deletes the aliases created by a test, with their relations
+func cleanAliases(t *testing.T, names ...string) {
+	aliases, err := ermis.GetObjectsByName(names)
+	if err != nil {
+		t.Errorf("failed to retrieve the aliases of the test: %v", err)
+		return
+	}
+	for _, alias := range aliases {
+		if err := ermis.DeleteTransactions(db.GetConn(), alias); err != nil {
+			t.Errorf("failed to delete the alias %v of the test: %v", alias.AliasName, err)
+		}
+	}
+}
+
+func TestCreateKeepsLegacyAuth(t *testing.T) {
+	requireDB(t)
+	type test struct {
+		caseID   int
+		alias    ermis.Alias
+		expected bool
+	}
+	testCases := []test{
+		//Case1: The owner disabled the plain secret, a create(or the rollback of a modification) keeps it disabled
+		{caseID: 1, alias: ermis.Alias{AliasName: "legacy-off.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1}, expected: false},
+		//Case2: The plain secret stays accepted otherwise
+		{caseID: 2, alias: ermis.Alias{AliasName: "legacy-on.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1, LegacyAuth: true}, expected: true},
+	}
+	for _, tc := range testCases {
+		if err := ermis.CreateTransactions(db.GetConn(), tc.alias); err != nil {
+			t.Errorf("Failed in TestCreateKeepsLegacyAuth for case ID:%v\nERROR:%v\n", tc.caseID, err)
+			continue
+		}
+		created, err := ermis.GetObjectsByName([]string{tc.alias.AliasName})
+		if err != nil || len(created) != 1 {
+			t.Errorf("Failed in TestCreateKeepsLegacyAuth for case ID:%v\nERROR:%v\n", tc.caseID, err)
+		} else if created[0].LegacyAuth != tc.expected {
+			t.Errorf("Failed in TestCreateKeepsLegacyAuth for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, created[0].LegacyAuth)
+		}
+		cleanAliases(t, tc.alias.AliasName)
+	}
+}
@@ -616,8 +616,48 @@ func TestValidation(t *testing.T) {
 			},
 			expected: false,
 		},
-		//Case 16: Malformed node name
+		//Case 16: Registered alarm type other than minimum
 		{caseID: 16,
+			input: ermis.Alias{
+				AliasName: "alias.cern.ch",
+				BestHosts: 1,
+				External:  "no",
+				Hostgroup: "aiermis",
+				Alarms: []ermis.Alarm{
+					{
+						ID:           1,
+						AlarmAliasID: 1,
+						Alias:        "alias.cern.ch",
+						Name:         "blacklisted_ratio",
+						Recipient:    "lb-experts@cern.ch",
+						Parameter:    50,
+					},
+				},
+			},
+			expected: true,
+		},
+		//Case 17: Parameter outside the schema of the alarm type
+		{caseID: 17,
+			input: ermis.Alias{
+				AliasName: "alias.cern.ch",
+				BestHosts: 1,
+				External:  "no",
+				Hostgroup: "aiermis",
+				Alarms: []ermis.Alarm{
+					{
+						ID:           1,
+						AlarmAliasID: 1,
+						Alias:        "alias.cern.ch",
+						Name:         "blacklisted_ratio",
+						Recipient:    "lb-experts@cern.ch",
+						Parameter:    150, //more than 100%
+					},
+				},
+			},
+			expected: false,
+		},
+		//Case 18: Malformed node name
+		{caseID: 18,
 			input: ermis.Alias{
 				AliasName: "seed.cern.ch",
 				BestHosts: 1,
@@ -643,3 +683,53 @@ func TestValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestFullAliasName(t *testing.T) {
+	type test struct {
+		caseID   int
+		input    string
+		expected string
+	}
+	testCases := []test{
+		{caseID: 1, input: "seed", expected: "seed.cern.ch"},
+		{caseID: 2, input: "seed.cern.ch", expected: "seed.cern.ch"},
+	}
+	for _, tc := range testCases {
+		output := ermis.FullAliasName(tc.input)
+		if output != tc.expected {
+			t.Errorf("Failed in TestFullAliasName\nFAILED CASE ID:%v\nINPUT:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.input, tc.expected, output)
+		}
+	}
+}
+
+func TestSplitAlarm(t *testing.T) {
+	type test struct {
+		caseID    int
+		input     string
+		recipient string
+		channel   string
+		ok        bool
+	}
+	testCases := []test{
+		//Case1: Plain e-mail, delivered by mail
+		{caseID: 1, input: "minimum:lb-experts@cern.ch:1", recipient: "lb-experts@cern.ch", channel: "mailto", ok: true},
+		//Case2: The recipient contains a colon
+		{caseID: 2, input: "minimum:webhook:ops:1", recipient: "webhook:ops", channel: "webhook", ok: true},
+		//Case3: Missing parameter
+		{caseID: 3, input: "minimum:lb-experts@cern.ch", ok: false},
+	}
+	for _, tc := range testCases {
+		name, recipient, parameter, ok := ermis.SplitAlarm(tc.input)
+		if ok != tc.ok {
+			t.Errorf("Failed in TestSplitAlarm for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		channel, _ := ermis.ParseRecipient(recipient)
+		if name != "minimum" || parameter != "1" || recipient != tc.recipient || channel != tc.channel {
+			t.Errorf("Failed in TestSplitAlarm for case ID:%v\nRECEIVED:%v %v %v %v\n", tc.caseID, name, recipient, parameter, channel)
+		}
+	}
+}
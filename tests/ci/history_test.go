@@ -0,0 +1,36 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+func TestDownsample(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes, load int) ermis.LoadPoint {
+		return ermis.LoadPoint{Time: start.Add(time.Duration(minutes) * time.Minute), Load: load}
+	}
+	points := []ermis.LoadPoint{at(0, 10), at(4, 20), at(9, 31), at(10, 5), at(25, 7)}
+	type test struct {
+		caseID   int
+		step     time.Duration
+		expected []ermis.LoadPoint
+	}
+	testCases := []test{
+		//Case1: No step keeps the points
+		{caseID: 1, step: 0, expected: points},
+		//Case2: Averages rounded to the closest integer, periods without points are skipped
+		{caseID: 2, step: 10 * time.Minute, expected: []ermis.LoadPoint{at(0, 20), at(10, 5), at(20, 7)}},
+		//Case3: A single period
+		{caseID: 3, step: time.Hour, expected: []ermis.LoadPoint{at(0, 15)}},
+	}
+	for _, tc := range testCases {
+		output := ermis.Downsample(points, tc.step)
+		if !reflect.DeepEqual(output, tc.expected) {
+			t.Errorf("Failed in TestDownsample for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
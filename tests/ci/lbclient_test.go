@@ -0,0 +1,71 @@
+package ci
+
+import (
+	"fmt"
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/api/lbclient"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`[{"AliasName":"seed.cern.ch","Load":3}]`)
+	type test struct {
+		caseID    int
+		secret    string
+		timestamp string
+		expected  string
+	}
+	testCases := []test{
+		//Case1: HMAC-SHA256 of "<timestamp>.<body>"
+		{caseID: 1, secret: "secret", timestamp: "1614592800",
+			expected: "221bacc8d9787db53aa592a506597410ec633ad7ef0e1082ba6b4ec1d3ff9503"},
+		//Case2: Another secret
+		{caseID: 2, secret: "other", timestamp: "1614592800",
+			expected: "5d8f9c7306fe0f1a1a4d53a869c9287ddb56acac8fbd7bc98ef080d591290713"},
+		//Case3: Another timestamp
+		{caseID: 3, secret: "secret", timestamp: "1614592801",
+			expected: "554e94ef992d9aabd13342da1c7351366469f350e5107b1e0728b2cc4d7dba7f"},
+	}
+	for _, tc := range testCases {
+		output := lbclient.Sign(tc.secret, tc.timestamp, body)
+		if output != tc.expected {
+			t.Errorf("Failed in TestSign for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestAcceptedSecrets(t *testing.T) {
+	//cached holds what the cache of this replica returns, stored what tbag has
+	cached := map[string]string{"seed.cern.ch": "current", "seed.cern.ch_next": "next", "fresh.cern.ch": "current"}
+	stored := map[string]string{"seed.cern.ch": "current", "fresh.cern.ch": "promoted"}
+	secretOf, freshSecretOf := lbclient.SecretOf, lbclient.FreshSecretOf
+	lbclient.SecretOf = func(aliasname string) string { return cached[aliasname] }
+	lbclient.FreshSecretOf = func(aliasname string) string { return stored[aliasname] }
+	defer func() { lbclient.SecretOf, lbclient.FreshSecretOf = secretOf, freshSecretOf }()
+
+	type test struct {
+		caseID   int
+		alias    string
+		state    string
+		expected []string
+	}
+	testCases := []test{
+		//Case1: Only the current secret outside a rotation
+		{caseID: 1, alias: "seed.cern.ch", state: "", expected: []string{"current"}},
+		//Case2: The current and the next secret while rotating
+		{caseID: 2, alias: "seed.cern.ch", state: ermis.RotationRotating, expected: []string{"current", "next"}},
+		//Case3: The cached secret and the fresh one after a promotion
+		{caseID: 3, alias: "fresh.cern.ch", state: ermis.RotationPromoted, expected: []string{"current", "promoted"}},
+		//Case4: The cache already has the promoted secret
+		{caseID: 4, alias: "seed.cern.ch", state: ermis.RotationPromoted, expected: []string{"current"}},
+		//Case5: An alias without secret
+		{caseID: 5, alias: "other.cern.ch", state: ermis.RotationRotating, expected: nil},
+	}
+	for _, tc := range testCases {
+		output := lbclient.AcceptedSecrets(tc.alias, tc.state)
+		if fmt.Sprint(output) != fmt.Sprint(tc.expected) {
+			t.Errorf("Failed in TestAcceptedSecrets for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
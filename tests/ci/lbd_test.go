@@ -0,0 +1,72 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+func TestRenderLBDConfig(t *testing.T) {
+	node := func(name string, blacklist bool) ermis.Relation {
+		return ermis.Relation{Node: &ermis.Node{NodeName: name}, Blacklist: blacklist}
+	}
+	alias := func(name string, relations ...ermis.Relation) ermis.Alias {
+		return ermis.Alias{AliasName: name, BestHosts: 2, External: "no", Metric: "cmsfrontier",
+			PollingInterval: 300, Statistics: "long", TTL: 60, Relations: relations}
+	}
+	type test struct {
+		caseID   int
+		aliases  []ermis.Alias
+		expected string
+	}
+	testCases := []test{
+		//Case1: Aliases and nodes sorted by name, the blacklisted nodes out of the cluster
+		{caseID: 1,
+			aliases: []ermis.Alias{
+				alias("seed.cern.ch", node("b.cern.ch", false), node("c.cern.ch", true), node("a.cern.ch", false)),
+				alias("empty.cern.ch")},
+			expected: "#lbd configuration generated by ermis, do not edit\n" +
+				"parameters empty.cern.ch = best_hosts#2 external#no metric#cmsfrontier polling_interval#300 statistics#long ttl#60\n" +
+				"clusters empty.cern.ch = \n" +
+				"parameters seed.cern.ch = best_hosts#2 external#no metric#cmsfrontier polling_interval#300 statistics#long ttl#60\n" +
+				"clusters seed.cern.ch = a.cern.ch b.cern.ch\n" +
+				"#blacklisted seed.cern.ch = c.cern.ch\n"},
+	}
+	for _, tc := range testCases {
+		output := ermis.RenderLBDConfig(tc.aliases)
+		if output != tc.expected {
+			t.Errorf("Failed in TestRenderLBDConfig for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+		//The same aliases in another order give the same checksum
+		reversed := []ermis.Alias{}
+		for i := len(tc.aliases) - 1; i >= 0; i-- {
+			reversed = append(reversed, tc.aliases[i])
+		}
+		if ermis.Checksum(ermis.RenderLBDConfig(reversed)) != ermis.Checksum(output) {
+			t.Errorf("Failed in TestRenderLBDConfig for case ID:%v, the checksum depends on the order", tc.caseID)
+		}
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	previous := "parameters a = best_hosts#2\nclusters a = n1 n2\nparameters b = best_hosts#1\nclusters b = n3\n"
+	type test struct {
+		caseID   int
+		current  string
+		expected []string
+	}
+	testCases := []test{
+		//Case1: No change
+		{caseID: 1, current: previous, expected: []string{}},
+		//Case2: A node removed from an alias and an alias added
+		{caseID: 2, current: "parameters a = best_hosts#2\nclusters a = n1\nparameters b = best_hosts#1\nclusters b = n3\nparameters c = best_hosts#1\nclusters c = n4\n",
+			expected: []string{"-clusters a = n1 n2", "+clusters a = n1", "+parameters c = best_hosts#1", "+clusters c = n4"}},
+	}
+	for _, tc := range testCases {
+		output := ermis.DiffConfigs(previous, tc.current)
+		if !reflect.DeepEqual(output, tc.expected) {
+			t.Errorf("Failed in TestDiffConfigs for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ci
+
+import (
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/db"
+	"gitlab.cern.ch/lb-experts/goermis/leader"
+	"gorm.io/gorm"
+)
+
+func TestAcquire(t *testing.T) {
+	requireDB(t)
+	if err := db.GetConn().AutoMigrate(&leader.Lease{}); err != nil {
+		t.Fatalf("failed to migrate the lease: %v", err)
+	}
+	db.GetConn().Where("1 = 1").Delete(&leader.Lease{})
+	defer db.GetConn().Where("1 = 1").Delete(&leader.Lease{})
+
+	//expire ends the lease as if its holder had stopped renewing it
+	expire := func() {
+		db.GetConn().Model(&leader.Lease{}).Where("1 = 1").Update("expiry", gorm.Expr("NOW() - INTERVAL 1 SECOND"))
+	}
+	type test struct {
+		caseID   int
+		holder   string
+		before   func()
+		expected bool
+	}
+	testCases := []test{
+		//Case1: The first replica creates the lease
+		{caseID: 1, holder: "replica-a", expected: true},
+		//Case2: The holder renews it
+		{caseID: 2, holder: "replica-a", expected: true},
+		//Case3: Another replica cannot take a lease that has not expired
+		{caseID: 3, holder: "replica-b", expected: false},
+		//Case4: Another replica steals an expired lease
+		{caseID: 4, holder: "replica-b", before: expire, expected: true},
+		//Case5: The previous holder lost it
+		{caseID: 5, holder: "replica-a", expected: false},
+	}
+	for _, tc := range testCases {
+		if tc.before != nil {
+			tc.before()
+		}
+		output, err := leader.Acquire(tc.holder)
+		if err != nil || output != tc.expected {
+			t.Errorf("Failed in TestAcquire for case ID:%v\nEXPECTED:%v\nRECEIVED:%v %v\n", tc.caseID, tc.expected, output, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+func TestNodeInAliases(t *testing.T) {
+	requireDB(t)
+	const node = "ermis-node.cern.ch"
+	names := map[string]string{"node-a.cern.ch": "aiermis", "node-b.cern.ch": "aiermis", "node-c.cern.ch": "other"}
+	var relations []ermis.Relation
+	for name, hostgroup := range names {
+		alias := ermis.Alias{AliasName: name, Hostgroup: hostgroup, External: "no", BestHosts: 1}
+		if err := ermis.CreateTransactions(db.GetConn(), alias); err != nil {
+			t.Fatalf("failed to create the alias %v of the test: %v", name, err)
+		}
+		created, err := ermis.GetObjectsByName([]string{name})
+		if err != nil || len(created) != 1 {
+			t.Fatalf("failed to retrieve the alias %v of the test: %v", name, err)
+		}
+		relations = append(relations, ermis.Relation{AliasID: created[0].ID})
+	}
+	defer db.GetConn().Where("node_name = ?", node).Delete(&ermis.Node{})
+	defer cleanAliases(t, "node-a.cern.ch", "node-b.cern.ch", "node-c.cern.ch")
+	if err := ermis.AddNodeInAliasesTransactions(ermis.Node{NodeName: node}, relations); err != nil {
+		t.Fatalf("failed to add the node of the test: %v", err)
+	}
+	ermis.SetUserProfile(ermis.User{Username: "nodes", Pwn: []string{"aiermis", "empty"}})
+	defer ermis.SetUserProfile(ermis.User{})
+
+	//blacklisted returns the aliases where the node is blacklisted
+	blacklisted := func() map[string]bool {
+		_, body := callHandler(ermis.GetNode, http.MethodGet, "/", "", []string{"name"}, []string{node})
+		resource := ermis.NodeResource{}
+		json.Unmarshal([]byte(body), &resource)
+		result := map[string]bool{}
+		for _, m := range resource.Aliases {
+			result[m.AliasName] = m.Blacklisted
+		}
+		return result
+	}
+	type test struct {
+		caseID   int
+		modify   bool
+		target   string
+		body     string
+		name     string
+		status   int
+		expected map[string]bool
+	}
+	testCases := []test{
+		//Case1: The hostgroup is required
+		{caseID: 1, modify: true, body: `{"blacklist":true}`, name: node, status: http.StatusBadRequest,
+			expected: map[string]bool{"node-a.cern.ch": false, "node-b.cern.ch": false, "node-c.cern.ch": false}},
+		//Case2: The user is not authorized in the hostgroup
+		{caseID: 2, modify: true, body: `{"hostgroup":"other","blacklist":true}`, name: node, status: http.StatusUnauthorized,
+			expected: map[string]bool{"node-a.cern.ch": false, "node-b.cern.ch": false, "node-c.cern.ch": false}},
+		//Case3: The node is not part of any alias of the hostgroup
+		{caseID: 3, modify: true, body: `{"hostgroup":"empty","blacklist":true}`, name: node, status: http.StatusNotFound,
+			expected: map[string]bool{"node-a.cern.ch": false, "node-b.cern.ch": false, "node-c.cern.ch": false}},
+		//Case4: A node that does not exist
+		{caseID: 4, modify: true, body: `{"hostgroup":"aiermis","blacklist":true}`, name: "ermis-none.cern.ch", status: http.StatusNotFound,
+			expected: map[string]bool{"node-a.cern.ch": false, "node-b.cern.ch": false, "node-c.cern.ch": false}},
+		//Case5: The node is blacklisted in every alias of the hostgroup, and only there
+		{caseID: 5, modify: true, body: `{"hostgroup":"aiermis","blacklist":true}`, name: node, status: http.StatusAccepted,
+			expected: map[string]bool{"node-a.cern.ch": true, "node-b.cern.ch": true, "node-c.cern.ch": false}},
+		//Case6: The node cannot be removed from the aliases of another hostgroup
+		{caseID: 6, target: "/?hostgroup=other", name: node, status: http.StatusUnauthorized,
+			expected: map[string]bool{"node-a.cern.ch": true, "node-b.cern.ch": true, "node-c.cern.ch": false}},
+		//Case7: The node is removed from every alias of the hostgroup, and only there
+		{caseID: 7, target: "/?hostgroup=aiermis", name: node, status: http.StatusOK,
+			expected: map[string]bool{"node-c.cern.ch": false}},
+	}
+	for _, tc := range testCases {
+		var status int
+		if tc.modify {
+			status, _ = callHandler(ermis.ModifyNode, http.MethodPatch, "/", tc.body, []string{"name"}, []string{tc.name})
+		} else {
+			status, _ = callHandler(ermis.RemoveNode, http.MethodDelete, tc.target, "", []string{"name"}, []string{tc.name})
+		}
+		if output := blacklisted(); status != tc.status || fmt.Sprint(output) != fmt.Sprint(tc.expected) {
+			t.Errorf("Failed in TestNodeInAliases for case ID:%v\nEXPECTED:%v %v\nRECEIVED:%v %v\n",
+				tc.caseID, tc.status, tc.expected, status, output)
+		}
+	}
+}
+
+func TestModifyNodeReply(t *testing.T) {
+	requireDB(t)
+	const node = "ermis-reply.cern.ch"
+	alias := ermis.Alias{AliasName: "node-reply.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1}
+	if err := ermis.CreateTransactions(db.GetConn(), alias); err != nil {
+		t.Fatalf("failed to create the alias of the test: %v", err)
+	}
+	defer db.GetConn().Where("node_name = ?", node).Delete(&ermis.Node{})
+	defer cleanAliases(t, alias.AliasName)
+	created, err := ermis.GetObjectsByName([]string{alias.AliasName})
+	if err != nil || len(created) != 1 {
+		t.Fatalf("failed to retrieve the alias of the test: %v", err)
+	}
+	if err := ermis.AddNodeInAliasesTransactions(ermis.Node{NodeName: node},
+		[]ermis.Relation{{AliasID: created[0].ID, Blacklist: true, AutoBlacklisted: true, Stale: true}}); err != nil {
+		t.Fatalf("failed to add the node of the test: %v", err)
+	}
+	ermis.SetUserProfile(ermis.User{Username: "nodes", Pwn: []string{"aiermis"}})
+	defer ermis.SetUserProfile(ermis.User{})
+
+	//The reply of the change has the shape of the GET, with the automatic blacklist cleared
+	_, reply := callHandler(ermis.ModifyNode, http.MethodPatch, "/", `{"hostgroup":"aiermis","blacklist":false}`,
+		[]string{"name"}, []string{node})
+	_, view := callHandler(ermis.GetNode, http.MethodGet, "/", "", []string{"name"}, []string{node})
+	if reply != view {
+		t.Errorf("Failed in TestModifyNodeReply\nEXPECTED:%v\nRECEIVED:%v\n", view, reply)
+	}
+}
@@ -0,0 +1,51 @@
+package ci
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/scheduler"
+)
+
+func TestCronNext(t *testing.T) {
+	//Monday 2021-03-01 10:07
+	from := time.Date(2021, 3, 1, 10, 7, 0, 0, time.UTC)
+	type test struct {
+		caseID   int
+		expr     string
+		expected time.Time
+		err      bool
+	}
+	testCases := []test{
+		//Case1: Every minute
+		{caseID: 1, expr: "* * * * *", expected: time.Date(2021, 3, 1, 10, 8, 0, 0, time.UTC)},
+		//Case2: Every 15 minutes
+		{caseID: 2, expr: "*/15 * * * *", expected: time.Date(2021, 3, 1, 10, 15, 0, 0, time.UTC)},
+		//Case3: Daily at 06:00, tomorrow
+		{caseID: 3, expr: "0 6 * * *", expected: time.Date(2021, 3, 2, 6, 0, 0, 0, time.UTC)},
+		//Case4: On Sundays, written as 7
+		{caseID: 4, expr: "30 2 * * 7", expected: time.Date(2021, 3, 7, 2, 30, 0, 0, time.UTC)},
+		//Case5: Lists and ranges
+		{caseID: 5, expr: "0,30 8-9 1 4 *", expected: time.Date(2021, 4, 1, 8, 0, 0, 0, time.UTC)},
+		//Case6: Either day of month or day of week
+		{caseID: 6, expr: "0 0 15 * 3", expected: time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)},
+		//Case7: Malformed expressions
+		{caseID: 7, expr: "* * * *", err: true},
+		{caseID: 8, expr: "61 * * * *", err: true},
+		{caseID: 9, expr: "*/0 * * * *", err: true},
+		{caseID: 10, expr: "a * * * *", err: true},
+	}
+	for _, tc := range testCases {
+		cron, err := scheduler.ParseCron(tc.expr)
+		if (err != nil) != tc.err {
+			t.Errorf("Failed in TestCronNext for case ID:%v\nEXPR:%v\nEXPECTED ERROR:%v\nRECEIVED:%v\n", tc.caseID, tc.expr, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if output := cron.Next(from); !output.Equal(tc.expected) {
+			t.Errorf("Failed in TestCronNext for case ID:%v\nEXPR:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expr, tc.expected, output)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package ci
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/auth"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+func TestFileStore(t *testing.T) {
+	const key = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	backend, err := auth.NewFileStore(path, key)
+	if err != nil {
+		t.Fatalf("Failed to open the store: %v", err)
+	}
+	store := auth.NewCachedStore(backend, time.Minute)
+	if err := store.Put("seed.cern.ch", "secret"); err != nil {
+		t.Fatalf("Failed to store the secret: %v", err)
+	}
+	type test struct {
+		caseID   int
+		store    auth.SecretStore
+		alias    string
+		expected string
+	}
+	//A second store on the same file reads what the first one wrote
+	reopened, _ := auth.NewFileStore(path, key)
+	testCases := []test{
+		//Case1: Cached secret
+		{caseID: 1, store: store, alias: "seed.cern.ch", expected: "secret"},
+		//Case2: Secret read from the file
+		{caseID: 2, store: reopened, alias: "seed.cern.ch", expected: "secret"},
+		//Case3: Alias without secret
+		{caseID: 3, store: store, alias: "other.cern.ch", expected: ""},
+	}
+	for _, tc := range testCases {
+		output, err := tc.store.Get(tc.alias)
+		if err != nil || output != tc.expected {
+			t.Errorf("Failed in TestFileStore for case ID:%v\nEXPECTED:%v\nRECEIVED:%v (%v)\n", tc.caseID, tc.expected, output, err)
+		}
+	}
+
+	//The secrets cannot be read with another key
+	other, _ := auth.NewFileStore(path, "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if _, err := other.Get("seed.cern.ch"); err == nil {
+		t.Errorf("Expected the decryption with another key to fail")
+	}
+	//Deleting invalidates the cache
+	if err := store.Delete("seed.cern.ch"); err != nil {
+		t.Fatalf("Failed to delete the secret: %v", err)
+	}
+	if output, _ := store.Get("seed.cern.ch"); output != "" {
+		t.Errorf("Expected no secret after the deletion, got %v", output)
+	}
+}
+
+func TestRotatingAliases(t *testing.T) {
+	requireDB(t)
+	if err := db.GetConn().AutoMigrate(&ermis.SecretRotation{}); err != nil {
+		t.Fatalf("failed to migrate the rotations: %v", err)
+	}
+	now := time.Now()
+	rotations := []ermis.SecretRotation{
+		{Alias: "rotating.cern.ch", State: ermis.RotationRotating, PromoteAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+		{Alias: "promoted.cern.ch", State: ermis.RotationIdle, LastRotation: sql.NullTime{Time: now, Valid: true}},
+		{Alias: "idle.cern.ch", State: ermis.RotationIdle, LastRotation: sql.NullTime{Time: now.Add(-auth.CacheTTL() - time.Minute), Valid: true}},
+	}
+	names := []string{"rotating.cern.ch", "promoted.cern.ch", "idle.cern.ch", "never.cern.ch"}
+	db.GetConn().Where("alias IN ?", names).Delete(&ermis.SecretRotation{})
+	defer db.GetConn().Where("alias IN ?", names).Delete(&ermis.SecretRotation{})
+	if err := db.GetConn().Create(&rotations).Error; err != nil {
+		t.Fatalf("failed to store the rotations of the test: %v", err)
+	}
+
+	output, err := ermis.RotatingAliases(names)
+	//The idle aliases and the ones never rotated are left out
+	expected := map[string]string{"rotating.cern.ch": ermis.RotationRotating, "promoted.cern.ch": ermis.RotationPromoted}
+	if err != nil || fmt.Sprint(output) != fmt.Sprint(expected) {
+		t.Errorf("Failed in TestRotatingAliases\nEXPECTED:%v\nRECEIVED:%v %v\n", expected, output, err)
+	}
+}
+
+func TestPromoteSecrets(t *testing.T) {
+	requireDB(t)
+	if err := db.GetConn().AutoMigrate(&ermis.SecretRotation{}); err != nil {
+		t.Fatalf("failed to migrate the rotations: %v", err)
+	}
+	backend, err := auth.NewFileStore(filepath.Join(t.TempDir(), "secrets.json"),
+		"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("Failed to open the store: %v", err)
+	}
+	auth.SetStore(auth.NewCachedStore(backend, time.Minute))
+	const alias = "promote.cern.ch"
+	auth.PostSecret(alias, "current")
+	auth.PostSecret(ermis.NextSecretName(alias), "next")
+	db.GetConn().Where("alias = ?", alias).Delete(&ermis.SecretRotation{})
+	defer db.GetConn().Where("alias = ?", alias).Delete(&ermis.SecretRotation{})
+	if err := db.GetConn().Create(&ermis.SecretRotation{Alias: alias, State: ermis.RotationRotating,
+		PromoteAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}}).Error; err != nil {
+		t.Fatalf("failed to store the rotation of the test: %v", err)
+	}
+
+	ermis.PromoteSecrets()
+	var rotation ermis.SecretRotation
+	db.GetConn().Where("alias = ?", alias).First(&rotation)
+	//The next secret is current, and is deleted once the promotion is stored
+	output := []string{auth.GetSecret(alias), auth.GetSecret(ermis.NextSecretName(alias)), rotation.State}
+	expected := []string{"next", "", ermis.RotationIdle}
+	if fmt.Sprint(output) != fmt.Sprint(expected) {
+		t.Errorf("Failed in TestPromoteSecrets\nEXPECTED:%v\nRECEIVED:%v\n", expected, output)
+	}
+}
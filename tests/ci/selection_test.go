@@ -0,0 +1,74 @@
+package ci
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+func TestSelectBestHosts(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	recent := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	old := sql.NullTime{Time: now.Add(-2 * time.Hour), Valid: true}
+	node := func(name string, load int, update sql.NullTime, blacklist bool) ermis.Relation {
+		return ermis.Relation{Node: &ermis.Node{NodeName: name}, Load: load, LastLoadUpdate: update, Blacklist: blacklist}
+	}
+	relations := []ermis.Relation{
+		node("a.cern.ch", 30, recent, false),
+		node("b.cern.ch", 10, recent, false),
+		node("c.cern.ch", 20, recent, false),
+		node("d.cern.ch", 5, recent, true),
+		node("e.cern.ch", 1, old, false),
+		node("f.cern.ch", -1, recent, false),
+		node("g.cern.ch", 0, sql.NullTime{}, false),
+		node("h.cern.ch", 10, recent, false),
+	}
+	type test struct {
+		caseID   int
+		best     int
+		selected []string
+		excluded map[string]string
+	}
+	excluded := map[string]string{
+		"d.cern.ch": ermis.ExcludedBlacklisted,
+		"e.cern.ch": ermis.ExcludedStale,
+		"f.cern.ch": ermis.ExcludedNegative,
+		"g.cern.ch": ermis.ExcludedNoReport,
+	}
+	withNotBest := func(names ...string) map[string]string {
+		m := map[string]string{}
+		for k, v := range excluded {
+			m[k] = v
+		}
+		for _, n := range names {
+			m[n] = ermis.ExcludedNotBest
+		}
+		return m
+	}
+	testCases := []test{
+		//Case1: The two lowest loads, ties ordered by name
+		{caseID: 1, best: 2, selected: []string{"b.cern.ch", "h.cern.ch"}, excluded: withNotBest("a.cern.ch", "c.cern.ch")},
+		//Case2: -1 picks every eligible node
+		{caseID: 2, best: -1, selected: []string{"b.cern.ch", "h.cern.ch", "c.cern.ch", "a.cern.ch"}, excluded: withNotBest()},
+		//Case3: More best hosts than eligible nodes
+		{caseID: 3, best: 10, selected: []string{"b.cern.ch", "h.cern.ch", "c.cern.ch", "a.cern.ch"}, excluded: withNotBest()},
+	}
+	for _, tc := range testCases {
+		output := ermis.SelectBestHosts(ermis.Alias{AliasName: "seed.cern.ch", BestHosts: tc.best, Relations: relations}, now)
+		selected := []string{}
+		for _, n := range output.Selected {
+			selected = append(selected, n.NodeName)
+		}
+		reasons := map[string]string{}
+		for _, n := range output.Excluded {
+			reasons[n.NodeName] = n.Reason
+		}
+		if !reflect.DeepEqual(selected, tc.selected) || !reflect.DeepEqual(reasons, tc.excluded) {
+			t.Errorf("Failed in TestSelectBestHosts for case ID:%v\nEXPECTED:%v %v\nRECEIVED:%v %v\n",
+				tc.caseID, tc.selected, tc.excluded, selected, reasons)
+		}
+	}
+}
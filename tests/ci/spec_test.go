@@ -0,0 +1,197 @@
+package ci
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+)
+
+var specAlias = ermis.Alias{
+	ID:        1,
+	AliasName: "seed.cern.ch",
+	Hostgroup: "aiermis",
+	External:  "no",
+	BestHosts: 2,
+	TTL:       60,
+	Relations: []ermis.Relation{
+		{Blacklist: true, Node: &ermis.Node{NodeName: "node2.cern.ch"}},
+		{Blacklist: false, Node: &ermis.Node{NodeName: "node1.cern.ch"}},
+	},
+	Cnames: []ermis.Cname{{Cname: "seedb"}, {Cname: "seeda"}},
+	Alarms: []ermis.Alarm{{Name: "minimum", Recipient: "lb-experts@cern.ch", Parameter: 1}},
+}
+
+func TestToSpec(t *testing.T) {
+	expected := ermis.AliasSpec{
+		Name:      "seed.cern.ch",
+		Hostgroup: "aiermis",
+		View:      "internal",
+		BestHosts: 2,
+		TTL:       60,
+		Nodes: []ermis.NodeSpec{
+			{Name: "node1.cern.ch", Blacklisted: false},
+			{Name: "node2.cern.ch", Blacklisted: true},
+		},
+		Cnames: []string{"seeda", "seedb"},
+		Alarms: []ermis.AlarmSpec{{Name: "minimum", Recipient: "lb-experts@cern.ch", Parameter: 1}},
+	}
+	output := ermis.ToSpec(specAlias)
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("Failed in TestToSpec\nEXPECTED:\n%+v\nRECEIVED:\n%+v\n", expected, output)
+	}
+}
+
+func TestDiffSpec(t *testing.T) {
+	type test struct {
+		caseID   int
+		input    ermis.AliasSpec
+		expected []string
+	}
+	testCases := []test{
+		//Case 1: Same spec, written differently
+		{caseID: 1,
+			input: ermis.AliasSpec{
+				Name: "seed",
+				View: "no",
+				Nodes: []ermis.NodeSpec{
+					{Name: "node2.cern.ch", Blacklisted: true},
+					{Name: "node1.cern.ch"},
+				},
+				Cnames: []string{"seedb", "seeda"},
+				Alarms: []ermis.AlarmSpec{{Name: "minimum", Recipient: "lb-experts@cern.ch", Parameter: 1}},
+			},
+			expected: nil,
+		},
+		//Case 2: Every kind of change
+		{caseID: 2,
+			input: ermis.AliasSpec{
+				Name:      "seed.cern.ch",
+				View:      "external",
+				BestHosts: 3,
+				Nodes: []ermis.NodeSpec{
+					{Name: "node1.cern.ch", Blacklisted: true},
+					{Name: "node3.cern.ch"},
+				},
+				Cnames: []string{"seeda"},
+			},
+			expected: []string{
+				"view: internal -> external",
+				"best_hosts: 2 -> 3",
+				"node node1.cern.ch blacklisted: false -> true",
+				"add node node3.cern.ch (blacklisted: false)",
+				"remove node node2.cern.ch",
+				"remove cname seedb",
+				"remove alarm minimum:lb-experts@cern.ch:1",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		output := ermis.DiffSpec(ermis.ToSpec(specAlias), tc.input)
+		if !reflect.DeepEqual(output, tc.expected) {
+			t.Errorf("Failed in TestDiffSpec\nFAILED CASE ID:%v\nEXPECTED:\n%v\nRECEIVED:\n%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
+
+func TestPlanSpecs(t *testing.T) {
+	other := ermis.Alias{AliasName: "other.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1}
+	foreign := ermis.Alias{AliasName: "foreign.cern.ch", Hostgroup: "ailbd", External: "no", BestHosts: 1}
+	doc := ermis.SpecDocument{
+		Version: ermis.SpecVersion,
+		Aliases: []ermis.AliasSpec{
+			ermis.ToSpec(specAlias),
+			{Name: "new", Hostgroup: "aiermis", View: "internal", BestHosts: 1},
+		},
+	}
+	type test struct {
+		caseID   int
+		prune    bool
+		expected map[string]string
+	}
+	testCases := []test{
+		{caseID: 1, prune: false,
+			expected: map[string]string{"new.cern.ch": "create", "seed.cern.ch": "none"}},
+		//Only aliases of the hostgroups in the document are pruned
+		{caseID: 2, prune: true,
+			expected: map[string]string{"new.cern.ch": "create", "seed.cern.ch": "none", "other.cern.ch": "delete"}},
+	}
+	for _, tc := range testCases {
+		plan, err := ermis.PlanSpecs(doc, []ermis.Alias{specAlias, other, foreign}, tc.prune)
+		if err != nil {
+			t.Errorf("Failed in TestPlanSpecs\nFAILED CASE ID:%v\nERROR:%v\n", tc.caseID, err)
+			continue
+		}
+		output := make(map[string]string)
+		for _, change := range plan.Changes {
+			output[change.AliasName] = change.Action
+		}
+		if !reflect.DeepEqual(output, tc.expected) {
+			t.Errorf("Failed in TestPlanSpecs\nFAILED CASE ID:%v\nEXPECTED:\n%v\nRECEIVED:\n%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+
+	//An alias described twice is refused
+	doc.Aliases = append(doc.Aliases, ermis.AliasSpec{Name: "seed"})
+	if _, err := ermis.PlanSpecs(doc, []ermis.Alias{specAlias}, false); err == nil {
+		t.Errorf("Failed in TestPlanSpecs, an alias described twice was accepted")
+	}
+}
+
+func TestPlanReconciliation(t *testing.T) {
+	other := ermis.Alias{AliasName: "other.cern.ch", Hostgroup: "aiermis", External: "no", BestHosts: 1}
+	foreign := ermis.Alias{AliasName: "foreign.cern.ch", Hostgroup: "ailbd", External: "no", BestHosts: 1}
+	existing := []ermis.Alias{specAlias, other, foreign}
+	file := func(name, hostgroup string, aliases ...ermis.AliasSpec) ermis.SpecFile {
+		return ermis.SpecFile{Name: name, Doc: ermis.SpecDocument{Version: ermis.SpecVersion, Hostgroup: hostgroup, Aliases: aliases}}
+	}
+	seed := ermis.ToSpec(specAlias)
+	fresh := ermis.AliasSpec{Name: "new", Hostgroup: "aiermis", View: "internal", BestHosts: 1}
+	otherSpec := ermis.ToSpec(other)
+	type test struct {
+		caseID   int
+		files    []ermis.SpecFile
+		prune    bool
+		expected map[string]map[string]string
+	}
+	testCases := []test{
+		//Case1: A file cannot manage the aliases of another hostgroup, nor move an alias to it
+		{caseID: 1, files: []ermis.SpecFile{
+			file("a.yaml", "aiermis", ermis.AliasSpec{Name: "foreign", Hostgroup: "aiermis", View: "internal", BestHosts: 1},
+				ermis.AliasSpec{Name: "moved", Hostgroup: "ailbd", View: "internal", BestHosts: 1})},
+			expected: map[string]map[string]string{"a.yaml": {"foreign.cern.ch": "403", "moved.cern.ch": "403"}}},
+		//Case2: An alias described by a previous file is refused
+		{caseID: 2, files: []ermis.SpecFile{file("a.yaml", "aiermis", fresh), file("b.yaml", "aiermis", fresh)},
+			expected: map[string]map[string]string{"a.yaml": {"new.cern.ch": "create"}, "b.yaml": {"new.cern.ch": "409"}}},
+		//Case3: The aliases missing from all the files of the hostgroup are pruned
+		{caseID: 3, prune: true, files: []ermis.SpecFile{file("a.yaml", "aiermis", seed)},
+			expected: map[string]map[string]string{"a.yaml": {"seed.cern.ch": "none", "other.cern.ch": "delete"}}},
+		//Case4: The aliases of a sibling file in error are not pruned
+		{caseID: 4, prune: true, files: []ermis.SpecFile{file("a.yaml", "aiermis", seed), file("b.yaml", "aiermis", otherSpec, otherSpec)},
+			expected: map[string]map[string]string{"a.yaml": {"seed.cern.ch": "none"}, "b.yaml": {}}},
+		//Case5: Nothing is pruned if the owner of a file in error is unknown
+		{caseID: 5, prune: true, files: []ermis.SpecFile{file("a.yaml", "aiermis", seed), {Name: "b.yaml", Err: errors.New("failed to decode")}},
+			expected: map[string]map[string]string{"a.yaml": {"seed.cern.ch": "none"}, "b.yaml": {}}},
+		//Case6: A file in error of another hostgroup does not prevent the pruning
+		{caseID: 6, prune: true, files: []ermis.SpecFile{file("a.yaml", "aiermis", seed),
+			{Name: "b.yaml", Doc: ermis.SpecDocument{Hostgroup: "ailbd"}, Err: errors.New("unsupported spec version")}},
+			expected: map[string]map[string]string{"a.yaml": {"seed.cern.ch": "none", "other.cern.ch": "delete"}, "b.yaml": {}}},
+	}
+	for _, tc := range testCases {
+		output := make(map[string]map[string]string)
+		for name, status := range ermis.PlanReconciliation(tc.files, existing, tc.prune) {
+			output[name] = make(map[string]string)
+			for _, change := range status.Changes {
+				output[name][change.AliasName] = change.Action
+				if change.Status != 0 {
+					output[name][change.AliasName] = fmt.Sprint(change.Status)
+				}
+			}
+		}
+		if !reflect.DeepEqual(output, tc.expected) {
+			t.Errorf("Failed in TestPlanReconciliation for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+}
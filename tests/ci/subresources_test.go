@@ -0,0 +1,125 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.cern.ch/lb-experts/goermis/api/ermis"
+	"gitlab.cern.ch/lb-experts/goermis/db"
+)
+
+//statusRenderer stands in for the templates, the cname handlers reply with a page
+type statusRenderer struct{}
+
+func (statusRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	return nil
+}
+
+//callHandler runs a handler on target and returns the status and the body of its reply
+func callHandler(handler echo.HandlerFunc, method, target, body string, names, values []string) (int, string) {
+	e := echo.New()
+	e.Renderer = statusRenderer{}
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	if err := handler(c); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code, fmt.Sprint(he.Message)
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	return rec.Code, rec.Body.String()
+}
+
+func TestSubresources(t *testing.T) {
+	requireDB(t)
+	for _, name := range []string{"sub-a.cern.ch", "sub-b.cern.ch"} {
+		alias := ermis.Alias{AliasName: name, Hostgroup: "aiermis", External: "no", BestHosts: 1,
+			Cnames: []ermis.Cname{{Cname: "sub-cname-" + name[4:5]}},
+			Alarms: []ermis.Alarm{{Alias: name, Name: "minimum", Recipient: "ermis@cern.ch", Parameter: 1}}}
+		if err := ermis.CreateTransactions(db.GetConn(), alias); err != nil {
+			t.Fatalf("failed to create the alias %v of the test: %v", name, err)
+		}
+	}
+	defer cleanAliases(t, "sub-a.cern.ch", "sub-b.cern.ch")
+	aliases, err := ermis.GetObjectsByName([]string{"sub-a.cern.ch", "sub-b.cern.ch"})
+	if err != nil || len(aliases) != 2 {
+		t.Fatalf("failed to retrieve the aliases of the test: %v", err)
+	}
+	a, b := aliases[0], aliases[1]
+	if a.AliasName != "sub-a.cern.ch" {
+		a, b = b, a
+	}
+	aID := strconv.Itoa(a.ID)
+	ownAlarm := strconv.Itoa(a.Alarms[0].ID)
+	otherAlarm := strconv.Itoa(b.Alarms[0].ID)
+
+	type test struct {
+		caseID   int
+		handler  echo.HandlerFunc
+		method   string
+		body     string
+		names    []string
+		values   []string
+		expected int
+	}
+	testCases := []test{
+		//Case1: The alarms of the alias are listed
+		{caseID: 1, handler: ermis.GetAlarms, method: http.MethodGet, names: []string{"id"}, values: []string{aID}, expected: http.StatusOK},
+		//Case2: An alias that does not exist
+		{caseID: 2, handler: ermis.GetAlarms, method: http.MethodGet, names: []string{"id"}, values: []string{"sub-none"}, expected: http.StatusNotFound},
+		//Case3: An alarm is added
+		{caseID: 3, handler: ermis.AddAlarm, method: http.MethodPost, body: `{"name":"minimum","recipient":"ermis@cern.ch","parameter":2}`,
+			names: []string{"id"}, values: []string{aID}, expected: http.StatusCreated},
+		//Case4: The same alarm twice
+		{caseID: 4, handler: ermis.AddAlarm, method: http.MethodPost, body: `{"name":"minimum","recipient":"ermis@cern.ch","parameter":2}`,
+			names: []string{"id"}, values: []string{aID}, expected: http.StatusConflict},
+		//Case5: An alarm without its parameter
+		{caseID: 5, handler: ermis.AddAlarm, method: http.MethodPost, body: `{"name":"minimum","recipient":"ermis@cern.ch"}`,
+			names: []string{"id"}, values: []string{aID}, expected: http.StatusBadRequest},
+		//Case6: The alarm of the alias is modified
+		{caseID: 6, handler: ermis.ModifyAlarm, method: http.MethodPatch, body: `{"parameter":3}`,
+			names: []string{"id", "alarm"}, values: []string{aID, ownAlarm}, expected: http.StatusAccepted},
+		//Case7: The alarm of another alias is refused
+		{caseID: 7, handler: ermis.ModifyAlarm, method: http.MethodPatch, body: `{"parameter":3}`,
+			names: []string{"id", "alarm"}, values: []string{aID, otherAlarm}, expected: http.StatusNotFound},
+		//Case8: The alarm of another alias is not removed either
+		{caseID: 8, handler: ermis.RemoveAlarm, method: http.MethodDelete,
+			names: []string{"id", "alarm"}, values: []string{aID, otherAlarm}, expected: http.StatusNotFound},
+		//Case9: A wrong alarm id
+		{caseID: 9, handler: ermis.RemoveAlarm, method: http.MethodDelete,
+			names: []string{"id", "alarm"}, values: []string{aID, "minimum"}, expected: http.StatusBadRequest},
+		//Case10: The alarm of the alias is removed
+		{caseID: 10, handler: ermis.RemoveAlarm, method: http.MethodDelete,
+			names: []string{"id", "alarm"}, values: []string{aID, ownAlarm}, expected: http.StatusOK},
+		//Case11: A cname that already exists
+		{caseID: 11, handler: ermis.AddCname, method: http.MethodPost,
+			names: []string{"id", "cname"}, values: []string{aID, "sub-cname-a"}, expected: http.StatusConflict},
+		//Case12: A cname that is not valid
+		{caseID: 12, handler: ermis.AddCname, method: http.MethodPost,
+			names: []string{"id", "cname"}, values: []string{aID, "-sub_cname"}, expected: http.StatusBadRequest},
+		//Case13: The cname of another alias cannot be removed through this one
+		{caseID: 13, handler: ermis.RemoveCname, method: http.MethodDelete,
+			names: []string{"id", "cname"}, values: []string{aID, "sub-cname-b"}, expected: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		output, _ := callHandler(tc.handler, tc.method, "/", tc.body, tc.names, tc.values)
+		if output != tc.expected {
+			t.Errorf("Failed in TestSubresources for case ID:%v\nEXPECTED:%v\nRECEIVED:%v\n", tc.caseID, tc.expected, output)
+		}
+	}
+	//The alarm of the other alias is left untouched
+	if retrieved, err := ermis.GetObjectsByName([]string{"sub-b.cern.ch"}); err != nil || len(retrieved) != 1 ||
+		len(retrieved[0].Alarms) != 1 || retrieved[0].Alarms[0].Parameter != 1 {
+		t.Errorf("Failed in TestSubresources\nEXPECTED:the alarm of sub-b.cern.ch unchanged\nRECEIVED:%v %v\n", retrieved, err)
+	}
+}